@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	ory "github.com/comnoco/vault-plugin-auth-ory/plugin"
+
+	"github.com/hashicorp/vault/api"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run logs in to Vault with the Ory auth method, as 'vault login -method=ory' would,
+// and stores the token where the Vault CLI's default token helper reads it.
+func run(args []string) int {
+	handler := &ory.CLIHandler{}
+
+	flags := flag.NewFlagSet("vault-login-ory", flag.ContinueOnError)
+	tokenOnly := flags.Bool("token-only", false, "Print only the token, and do not store it.")
+	noStore := flags.Bool("no-store", false, "Do not store the token in ~/.vault-token.")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, strings.Replace(handler.Help(), "vault login -method=ory", "vault-login-ory [-token-only] [-no-store]", 1))
+		fmt.Fprintln(os.Stderr)
+		flags.PrintDefaults()
+	}
+
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	config := map[string]string{}
+	for _, arg := range flags.Args() {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "invalid argument %q, expected K=V\n", arg)
+			return 2
+		}
+
+		config[key] = value
+	}
+
+	client, err := api.NewClient(api.DefaultConfig())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to create vault client: %v\n", err)
+		return 1
+	}
+
+	secret, err := handler.Auth(client, config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to log in: %v\n", err)
+		return 1
+	}
+
+	for _, warning := range secret.Warnings {
+		fmt.Fprintf(os.Stderr, "WARNING! %s\n", warning)
+	}
+
+	if *tokenOnly {
+		fmt.Println(secret.Auth.ClientToken)
+		return 0
+	}
+
+	if !*noStore {
+		err = storeToken(secret.Auth.ClientToken)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to store token: %v\n", err)
+			return 1
+		}
+	}
+
+	fmt.Println("Success! You are now authenticated.")
+	fmt.Println()
+	fmt.Printf("token:          %s\n", secret.Auth.ClientToken)
+	fmt.Printf("token_duration: %ds\n", secret.Auth.LeaseDuration)
+	fmt.Printf("policies:       %s\n", strings.Join(secret.Auth.Policies, ", "))
+
+	return 0
+}
+
+// storeToken writes the token to ~/.vault-token, the file of the Vault CLI's default token helper.
+func storeToken(token string) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(home, ".vault-token"), []byte(token), 0o600)
+}
@@ -3,6 +3,7 @@ package plugin
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -10,6 +11,8 @@ import (
 	keto "github.com/ory/keto/proto/ory/keto/relation_tuples/v1alpha2"
 	kratos "github.com/ory/kratos-client-go"
 
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
 )
 
@@ -34,39 +37,119 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 type OryAuthBackend struct {
 	*framework.Backend
 
-	kratosClient      *kratos.APIClient
+	kratosClient      *KratosClient
 	kratosClientMutex sync.RWMutex
 
 	ketoClient      *KetoClient
 	ketoClientMutex sync.RWMutex
+
+	// ketoDialOptions are added to the dial options of Keto connections, such as a dialer for in-process servers in tests.
+	ketoDialOptions []grpc.DialOption
+
+	hydraClient      *HydraClient
+	hydraClientMutex sync.RWMutex
+
+	jwtVerifier      *JWTVerifier
+	jwtVerifierMutex sync.RWMutex
+
+	sessionCache      *SessionCache
+	sessionCacheMutex sync.RWMutex
+
+	checkCache      *CheckCache
+	checkCacheMutex sync.RWMutex
+
+	tracer      *Tracer
+	tracerMutex sync.RWMutex
+
+	rateLimiter      *RateLimiter
+	rateLimiterMutex sync.RWMutex
+
+	identityGrantMutex sync.Mutex
+
+	// loginAuditSequence is the sequence number of the next login audit record, once loginAuditLoaded is set.
+	// loginAuditHead is the head last stored, and loginAuditMutex serialises loading and storing it.
+	loginAuditSequence atomic.Uint64
+	loginAuditLoaded   atomic.Bool
+	loginAuditHead     uint64
+	loginAuditMutex    sync.Mutex
+
+	// loginAuditLimiter limits the rate login audit records are written at.
+	loginAuditLimiter *rate.Limiter
+
+	// upstreamGroup coalesces concurrent identical calls to Kratos and Keto.
+	upstreamGroup singleflight.Group
+}
+
+// KratosClient is a client for the Ory Kratos API.
+type KratosClient struct {
+	// PublicClient is the client for the Kratos public API.
+	PublicClient *kratos.APIClient
+
+	// AdminClient is the client for the Kratos admin API.
+	AdminClient *kratos.APIClient
+
+	// policy is the timeout, retry and circuit breaker policy of calls to Kratos.
+	policy *callPolicy
 }
 
 // KetoClient is a client for the Ory Keto API.
 type KetoClient struct {
-	// conn is the gRPC connection to the Keto API.
-	conn *grpc.ClientConn
+	// readConn is the gRPC connection to the Keto read API.
+	readConn *grpc.ClientConn
+
+	// writeConn is the gRPC connection to the Keto write API.
+	writeConn *grpc.ClientConn
 
 	// CheckServiceClient is the client for the Keto Check API.
 	CheckServiceClient keto.CheckServiceClient
+
+	// ReadServiceClient is the client for the Keto Read API.
+	ReadServiceClient keto.ReadServiceClient
+
+	// ExpandServiceClient is the client for the Keto Expand API.
+	ExpandServiceClient keto.ExpandServiceClient
+
+	// VersionServiceClient is the client for the Keto Version API.
+	VersionServiceClient keto.VersionServiceClient
+
+	// WriteServiceClient is the client for the Keto Write API.
+	WriteServiceClient keto.WriteServiceClient
+
+	// policy is the timeout, retry and circuit breaker policy of checks with Keto.
+	policy *callPolicy
+
+	// inflight counts the requests using the client, which must finish before its connections are closed.
+	inflight sync.WaitGroup
 }
 
 // NewBackend returns a new instance of the Ory-backed auth backend.
 func NewBackend() *OryAuthBackend {
-	b := &OryAuthBackend{}
+	b := &OryAuthBackend{
+		loginAuditLimiter: rate.NewLimiter(loginAuditRate, loginAuditBurst),
+	}
 
 	b.Backend = &framework.Backend{
 		BackendType:  logical.TypeCredential,
 		Invalidate:   b.invalidateHandler,
+		Clean:        b.cleanupHandler,
 		PeriodicFunc: b.periodicHandler,
-		// AuthRenew:    b.authRenewHandler,
-		Help: help,
+		AuthRenew:    b.authRenewHandler,
+		Help:         help,
 		PathsSpecial: &logical.Paths{
-			Unauthenticated: []string{"login"},
+			Unauthenticated: []string{"login", "login/jwt"},
 			SealWrapStorage: []string{"config"},
 		},
 		Paths: framework.PathAppend(
 			NewPathConfig(b),
 			NewPathLogin(b),
+			NewPathLoginJWT(b),
+			NewPathLoginPreview(b),
+			NewPathKetoTuples(b),
+			NewPathKetoExplain(b),
+			NewPathIdentityGrant(b),
+			NewPathAuditLogins(b),
+			NewPathDeny(b),
+			NewPathSessionCache(b),
 		),
 	}
 
@@ -81,10 +164,21 @@ func (b *OryAuthBackend) Close() {
 
 	b.closeKratosClient()
 	b.closeKetoClient()
+	b.closeHydraClient()
+	b.closeJWTVerifier()
+	b.closeSessionCache()
+	b.closeCheckCache()
+	b.closeTracer()
+	b.closeRateLimiter()
 
 	b.Logger().Debug("closed backend")
 }
 
+// cleanupHandler is called when the backend is unmounted or the plugin is shut down.
+func (b *OryAuthBackend) cleanupHandler(_ context.Context) {
+	b.Close()
+}
+
 // invalidateHandler is called when the backend is invalidated.
 func (b *OryAuthBackend) invalidateHandler(_ context.Context, key string) {
 	b.Logger().Debug("invalidating backend", "key", key)
@@ -92,16 +186,36 @@ func (b *OryAuthBackend) invalidateHandler(_ context.Context, key string) {
 	switch key {
 	case "config":
 		b.Close()
+	case loginAuditHeadStorageKey:
+		b.resetLoginAuditSequence()
 	}
 }
 
 // periodicHandler is called periodically to perform any backend tasks.
 func (b *OryAuthBackend) periodicHandler(ctx context.Context, req *logical.Request) error {
-	// TODO (TW) implement periodic handler (not necessarily a health check like below)
+	err := b.cleanupIdentityGrants(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+
+	err = b.cleanupLoginAudit(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+
+	err = b.cleanupDenyLists(ctx, req.Storage)
+	if err != nil {
+		return err
+	}
+
+	err = b.revokeDeniedTokens(ctx, req)
+	if err != nil {
+		return err
+	}
 
 	// b.Logger().Debug("running periodic healthCheck")
 
-	// err := b.checkKratosHealth(ctx, req.Storage)
+	// err = b.checkKratosHealth(ctx, req.Storage)
 	// if err != nil {
 	// 	return err
 	// }
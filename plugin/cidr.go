@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"github.com/hashicorp/vault/sdk/helper/cidrutil"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+)
+
+// checkBoundCIDRs returns a permission denied error if the address is not in the bound CIDRs of the configuration.
+// Logins are accepted from any address while no bound CIDRs are configured.
+func checkBoundCIDRs(config *Config, addr string) error {
+	if config == nil || config.CIDR == nil || len(config.CIDR.BoundCIDRs) == 0 {
+		return nil
+	}
+
+	boundCIDRs, err := parseutil.ParseAddrs(config.CIDR.BoundCIDRs)
+	if err != nil {
+		return errors.Wrap(err, "invalid bound_cidrs")
+	}
+
+	if !cidrutil.RemoteAddrIsOk(addr, boundCIDRs) {
+		return permissionDeniedError(errors.New("login is not allowed from this address"))
+	}
+
+	return nil
+}
+
+// setTokenBoundCIDRs binds the token issued by the auth to the configured token bound CIDRs,
+// or to the login bound CIDRs if no token bound CIDRs are configured.
+func setTokenBoundCIDRs(config *Config, auth *logical.Auth) error {
+	if config == nil || config.CIDR == nil {
+		return nil
+	}
+
+	cidrs := config.CIDR.tokenBoundCIDRs()
+	if len(cidrs) == 0 {
+		return nil
+	}
+
+	var err error
+	auth.BoundCIDRs, err = parseutil.ParseAddrs(cidrs)
+	if err != nil {
+		return errors.Wrap(err, "invalid token_bound_cidrs")
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLoginOutsideBoundCIDRs(t *testing.T) {
+	checkServer := &testKetoCheckServer{}
+	b, s := newTestLoginBackend(t, checkServer)
+	writeTestConfig(t, b, s, map[string]interface{}{"bound_cidrs": "10.0.0.0/8"})
+
+	res := testRateLimitedLogin(t, b, s, "192.168.1.1:1234", "cookie")
+	assertLoginErrorResponse(t, res, http.StatusForbidden, loginErrorPermissionDenied)
+
+	if got := checkServer.checks.Load(); got != 0 {
+		t.Errorf("Keto checks = %d, want 0 for a rejected address", got)
+	}
+
+	res = testRateLimitedLogin(t, b, s, "10.1.2.3:1234", "cookie")
+	if res == nil || res.Auth == nil {
+		t.Fatalf("expected a login from inside the bound CIDRs to succeed, got %v", res)
+	}
+}
+
+func TestLoginTokenBoundCIDRs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+		want   []string
+	}{
+		{
+			name:   "unbound",
+			config: map[string]interface{}{},
+		},
+		{
+			name:   "token_bound_cidrs",
+			config: map[string]interface{}{"bound_cidrs": "10.0.0.0/8", "token_bound_cidrs": "10.1.0.0/16,10.2.0.1/32"},
+			want:   []string{"10.1.0.0/16", "10.2.0.1"},
+		},
+		{
+			name:   "bound_cidrs",
+			config: map[string]interface{}{"bound_cidrs": "10.0.0.0/8"},
+			want:   []string{"10.0.0.0/8"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+			writeTestConfig(t, b, s, test.config)
+
+			res := testRateLimitedLogin(t, b, s, "10.1.2.3:1234", "cookie")
+			if res == nil || res.Auth == nil {
+				t.Fatalf("expected the login to succeed, got %v", res)
+			}
+
+			got := []string{}
+			for _, cidr := range res.Auth.BoundCIDRs {
+				got = append(got, cidr.String())
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("token bound CIDRs = %v, want %v", got, test.want)
+			}
+
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("token bound CIDRs = %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckBoundCIDRs(t *testing.T) {
+	config := &Config{CIDR: &CIDRConfig{BoundCIDRs: []string{"10.0.0.0/8", "192.168.1.1/32"}}}
+
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"10.1.2.3", true},
+		{"192.168.1.1", true},
+		{"192.168.1.2", false},
+		{"", false},
+	}
+
+	for _, test := range tests {
+		err := checkBoundCIDRs(config, test.addr)
+		if allowed := err == nil; allowed != test.allowed {
+			t.Errorf("%q allowed = %t, want %t (%v)", test.addr, allowed, test.allowed, err)
+		}
+	}
+
+	if err := checkBoundCIDRs(&Config{}, "192.168.1.2"); err != nil {
+		t.Errorf("expected any address without bound CIDRs, got %v", err)
+	}
+}
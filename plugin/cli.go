@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+const (
+	// cliDefaultMount is the mount path of the plugin when none is given.
+	cliDefaultMount = "ory"
+
+	// cliSessionCookieEnv is the environment variable the session cookie is read from when no other source is given.
+	cliSessionCookieEnv = "ORY_SESSION_COOKIE"
+)
+
+// CLIHandler logs in to Vault with an Ory Kratos session cookie.
+// It implements the login handler interface of the Vault CLI, for use as the 'ory' method of a custom Vault CLI build.
+type CLIHandler struct{}
+
+// Auth logs in with the session cookie and Keto relation given in m, and returns the secret carrying the Vault token.
+// A 'role', as other auth methods take, is rejected before logging in, since the Keto relation takes its place.
+func (h *CLIHandler) Auth(c *api.Client, m map[string]string) (*api.Secret, error) {
+	if role, ok := m["role"]; ok {
+		return nil, errors.Errorf(
+			"role %q is not supported: the ory auth method has no roles, the namespace, object and relation decide the policies", role)
+	}
+
+	mount, ok := m["mount"]
+	if !ok || mount == "" {
+		mount = cliDefaultMount
+	}
+
+	cookie, err := cliSessionCookie(m)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"kratos_session_cookie": cookie,
+	}
+
+	for _, key := range []string{"namespace", "object", "relation"} {
+		value := m[key]
+		if value == "" {
+			return nil, errors.Errorf("%q is required", key)
+		}
+
+		data[key] = value
+	}
+
+	path := fmt.Sprintf("auth/%s/login", strings.Trim(mount, "/"))
+
+	secret, err := c.Logical().Write(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil || secret.Auth == nil {
+		return nil, errors.New("empty response from credential provider")
+	}
+
+	return secret, nil
+}
+
+// Help returns the help text of the login handler.
+func (h *CLIHandler) Help() string {
+	help := `
+Usage: vault login -method=ory [CONFIG K=V...]
+
+  The Ory auth method logs in with an Ory Kratos session cookie, authorised
+  with Keto for the given namespace, object and relation.
+
+  The session cookie is read from 'session_cookie', from the file at
+  'session_cookie_file', or from the ORY_SESSION_COOKIE environment variable.
+
+  Log in with the session cookie in the environment:
+
+      $ vault login -method=ory namespace=files object=reports relation=view
+
+Configuration:
+
+  mount=<string>
+      Path where the Ory auth method is mounted. Defaults to "ory".
+
+  namespace=<string>
+      Keto namespace of the resource being authenticated against. Required.
+
+  object=<string>
+      Keto object being authenticated against. Required.
+
+  relation=<string>
+      Keto relation between the identity and the object. Required.
+
+  session_cookie=<string>
+      Kratos session cookie. Prefer the file or the environment variable,
+      which keep the cookie out of the shell history.
+
+  session_cookie_file=<string>
+      Path of a file holding the Kratos session cookie.
+
+  The Ory auth method has no roles, so 'role' is rejected; the namespace,
+  object and relation decide the policies of the token.
+`
+
+	return strings.TrimSpace(help)
+}
+
+// cliSessionCookie returns the session cookie from the configuration, the cookie file or the environment, in that order.
+func cliSessionCookie(m map[string]string) (string, error) {
+	if cookie := m["session_cookie"]; cookie != "" {
+		return cookie, nil
+	}
+
+	if path := m["session_cookie_file"]; path != "" {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read session_cookie_file")
+		}
+
+		cookie := strings.TrimSpace(string(contents))
+		if cookie == "" {
+			return "", errors.New("session_cookie_file is empty")
+		}
+
+		return cookie, nil
+	}
+
+	if cookie := os.Getenv(cliSessionCookieEnv); cookie != "" {
+		return cookie, nil
+	}
+
+	return "", errors.Errorf("no session cookie: set session_cookie, session_cookie_file or %s", cliSessionCookieEnv)
+}
@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// startTestVaultLogin serves a Vault API whose Ory login path issues a token,
+// and returns a client for it, the data of the last login and the number of logins.
+func startTestVaultLogin(t *testing.T) (*api.Client, *map[string]interface{}, *atomic.Int64) {
+	t.Helper()
+
+	loginData := map[string]interface{}{}
+	logins := &atomic.Int64{}
+
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/ory/login" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		logins.Add(1)
+		_ = json.NewDecoder(r.Body).Decode(&loginData)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"auth": {"client_token": "token", "policies": ["files_view"]}}`))
+	}))
+	t.Cleanup(vault.Close)
+
+	config := api.DefaultConfig()
+	config.Address = vault.URL
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatalf("creating client: %v", err)
+	}
+
+	return client, &loginData, logins
+}
+
+func TestCLIHandlerLogin(t *testing.T) {
+	client, loginData, _ := startTestVaultLogin(t)
+
+	secret, err := (&CLIHandler{}).Auth(client, map[string]string{
+		"namespace":      "files",
+		"object":         "reports",
+		"relation":       "view",
+		"session_cookie": "cookie",
+	})
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+
+	if secret.Auth.ClientToken != "token" {
+		t.Errorf("client token = %q, want token", secret.Auth.ClientToken)
+	}
+
+	if (*loginData)["kratos_session_cookie"] != "cookie" || (*loginData)["relation"] != "view" {
+		t.Errorf("unexpected login data %v", *loginData)
+	}
+}
+
+func TestCLIHandlerRejectsRole(t *testing.T) {
+	client, _, logins := startTestVaultLogin(t)
+
+	_, err := (&CLIHandler{}).Auth(client, map[string]string{
+		"role":           "admin",
+		"namespace":      "files",
+		"object":         "reports",
+		"relation":       "view",
+		"session_cookie": "cookie",
+	})
+	if err == nil || !strings.Contains(err.Error(), `role "admin" is not supported`) {
+		t.Errorf("expected the role to be rejected, got %v", err)
+	}
+
+	if got := logins.Load(); got != 0 {
+		t.Errorf("logins = %d, want none with a role", got)
+	}
+}
@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"context"
+
+	metrics "github.com/armon/go-metrics"
+)
+
+const (
+	// coalesceCallKratosSession is the coalesced call name of Kratos session validation.
+	coalesceCallKratosSession = "kratos_session"
+
+	// coalesceCallKetoCheck is the coalesced call name of Keto checks.
+	coalesceCallKetoCheck = "keto_check"
+)
+
+// coalesce runs fn once for concurrent calls with the same call name and key,
+// and returns its result to all of them.
+// fn runs with a context detached from the callers' by the upstream's call policy,
+// so the first caller giving up does not fail the call for the others.
+// It counts the upstream calls made and the calls that were coalesced into another one.
+func (b *OryAuthBackend) coalesce(
+	ctx context.Context,
+	call string,
+	key string,
+	policy *callPolicy,
+	fn func(ctx context.Context) (interface{}, error),
+) (interface{}, error) {
+	labels := []metrics.Label{{Name: "call", Value: call}}
+
+	executed := false
+	val, err, shared := b.upstreamGroup.Do(call+":"+key, func() (interface{}, error) {
+		executed = true
+
+		metrics.IncrCounterWithLabels(metricUpstreamCalls, 1, labels)
+
+		ctx, cancel := policy.detach(ctx)
+		defer cancel()
+
+		return fn(ctx)
+	})
+
+	if shared && !executed {
+		b.Logger().Debug("coalesced upstream call", "call", call)
+
+		metrics.IncrCounterWithLabels(metricUpstreamCoalesced, 1, labels)
+	}
+
+	return val, err
+}
@@ -0,0 +1,53 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCoalesceDetachesCallFromCallerContext(t *testing.T) {
+	b, _ := newTestBackend(t)
+
+	policy := &callPolicy{name: "test", timeout: time.Second, maxRetries: 1}
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: trace.FlagsSampled,
+	})
+
+	ctx, cancel := context.WithCancel(trace.ContextWithSpanContext(context.Background(), spanContext))
+
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	errs := make(chan error, 1)
+
+	go func() {
+		_, err := b.coalesce(ctx, "test", "key", policy, func(ctx context.Context) (interface{}, error) {
+			close(started)
+			<-proceed
+
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("shared call has no deadline")
+			}
+
+			if got := trace.SpanContextFromContext(ctx).TraceID(); got != spanContext.TraceID() {
+				t.Errorf("shared call trace ID = %s, want %s", got, spanContext.TraceID())
+			}
+
+			return nil, ctx.Err()
+		})
+		errs <- err
+	}()
+
+	<-started
+	cancel()
+	close(proceed)
+
+	if err := <-errs; err != nil {
+		t.Fatalf("shared call failed after the first caller's context was cancelled: %v", err)
+	}
+}
@@ -2,19 +2,48 @@ package plugin
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"net/http"
+	"time"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/logical"
 	keto "github.com/ory/keto-client-go/client"
 	kratos "github.com/ory/kratos-client-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultKratosPublicURL is the Kratos public API URL used when none is configured.
+	defaultKratosPublicURL = "https://localhost:4433"
+
+	// defaultKratosAdminURL is the Kratos admin API URL used when none is configured.
+	defaultKratosAdminURL = "https://localhost:4434"
+
+	// defaultKetoReadAddress is the Keto read API gRPC address used when none is configured.
+	defaultKetoReadAddress = "localhost:4466"
+
+	// defaultKetoWriteAddress is the Keto write API gRPC address used when none is configured.
+	defaultKetoWriteAddress = "localhost:4467"
 )
 
 // Config is the configuration for the plugin.
 type Config struct {
-	KratosAuthURL string `json:"kratos_auth_url"`
-	// TODO (TW) expose Kratos and Keto configuration options.
-	Kratos *KratosConfig `json:"kratos"          structs:"kratos" mapstructure:"kratos"`
-	Keto   *KetoConfig   `json:"keto"            structs:"keto"   mapstructure:"keto"`
+	Kratos *KratosConfig `json:"kratos"        structs:"kratos"        mapstructure:"kratos"`
+	Keto   *KetoConfig   `json:"keto"          structs:"keto"          mapstructure:"keto"`
+	Ory    *OryConfig    `json:"ory,omitempty" structs:"ory,omitempty" mapstructure:"ory,omitempty"`
+	Hydra  *HydraConfig  `json:"hydra,omitempty" structs:"hydra,omitempty" mapstructure:"hydra,omitempty"`
+	JWT    *JWTConfig    `json:"jwt,omitempty"   structs:"jwt,omitempty"   mapstructure:"jwt,omitempty"`
+
+	SessionCache *SessionCacheConfig `json:"sessionCache,omitempty" structs:"sessionCache,omitempty" mapstructure:"sessionCache,omitempty"`
+	CheckCache   *CheckCacheConfig   `json:"checkCache,omitempty"   structs:"checkCache,omitempty"   mapstructure:"checkCache,omitempty"`
+	Resilience   *ResilienceConfig   `json:"resilience,omitempty"   structs:"resilience,omitempty"   mapstructure:"resilience,omitempty"`
+	Tracing      *TracingConfig      `json:"tracing,omitempty"      structs:"tracing,omitempty"      mapstructure:"tracing,omitempty"`
+	RateLimit    *RateLimitConfig    `json:"rateLimit,omitempty"    structs:"rateLimit,omitempty"    mapstructure:"rateLimit,omitempty"`
+	CIDR         *CIDRConfig         `json:"cidr,omitempty"         structs:"cidr,omitempty"         mapstructure:"cidr,omitempty"`
+	Audit        *AuditConfig        `json:"audit,omitempty"        structs:"audit,omitempty"        mapstructure:"audit,omitempty"`
+	Token        *TokenConfig        `json:"token,omitempty"        structs:"token,omitempty"        mapstructure:"token,omitempty"`
 }
 
 // ServerVariable stores the information about a server variable
@@ -34,21 +63,147 @@ type ServerConfiguration struct {
 // ServerConfigurations stores multiple ServerConfiguration items
 type ServerConfigurations []ServerConfiguration
 
-// KratosConfig stores the configuration of the Kratos API client
+// KratosConfig stores the configuration of the Kratos API clients.
+// Servers are used for the public API and AdminServers for the admin API.
 type KratosConfig struct {
-	Host             string            `json:"host,omitempty"          structs:"host,omitempty"          mapstructure:"host,omitempty"`
-	Scheme           string            `json:"scheme,omitempty"        structs:"scheme,omitempty"        mapstructure:"scheme,omitempty"`
-	DefaultHeader    map[string]string `json:"defaultHeader,omitempty" structs:"defaultHeader,omitempty" mapstructure:"defaultHeader,omitempty"`
-	UserAgent        string            `json:"userAgent,omitempty"     structs:"userAgent,omitempty"     mapstructure:"userAgent,omitempty"`
-	Debug            bool              `json:"debug,omitempty"         structs:"debug,omitempty"         mapstructure:"debug,omitempty"`
-	Servers          ServerConfigurations
-	OperationServers map[string]ServerConfigurations
-	HTTPClient       *http.Client
+	Host             string                          `json:"host,omitempty"             structs:"host,omitempty"             mapstructure:"host,omitempty"`
+	Scheme           string                          `json:"scheme,omitempty"           structs:"scheme,omitempty"           mapstructure:"scheme,omitempty"`
+	DefaultHeader    map[string]string               `json:"defaultHeader,omitempty"    structs:"defaultHeader,omitempty"    mapstructure:"defaultHeader,omitempty"`
+	UserAgent        string                          `json:"userAgent,omitempty"        structs:"userAgent,omitempty"        mapstructure:"userAgent,omitempty"`
+	Debug            bool                            `json:"debug,omitempty"            structs:"debug,omitempty"            mapstructure:"debug,omitempty"`
+	Servers          ServerConfigurations            `json:"servers,omitempty"          structs:"servers,omitempty"          mapstructure:"servers,omitempty"`
+	AdminServers     ServerConfigurations            `json:"adminServers,omitempty"     structs:"adminServers,omitempty"     mapstructure:"adminServers,omitempty"`
+	OperationServers map[string]ServerConfigurations `json:"operationServers,omitempty" structs:"operationServers,omitempty" mapstructure:"operationServers,omitempty"`
+	TLS              *TLSConfig                      `json:"tls,omitempty"              structs:"tls,omitempty"              mapstructure:"tls,omitempty"`
+	HTTPClient       *http.Client                    `json:"-"                          structs:"-"                          mapstructure:"-"`
 }
 
-// KetoConfig stores the configuration of the Keto API client
+// KetoConfig stores the configuration of the Keto API client.
+// The TransportConfig host is the address of the read API.
 type KetoConfig struct {
 	TransportConfig *keto.TransportConfig `json:"transportConfig,omitempty" structs:"transportConfig,omitempty" mapstructure:"transportConfig,omitempty"`
+	// WriteAddress is the address of the Keto write API.
+	WriteAddress string `json:"writeAddress,omitempty" structs:"writeAddress,omitempty" mapstructure:"writeAddress,omitempty"`
+	// TLSEnabled enables TLS on the gRPC connection to Keto.
+	TLSEnabled bool       `json:"tlsEnabled,omitempty" structs:"tlsEnabled,omitempty" mapstructure:"tlsEnabled,omitempty"`
+	TLS        *TLSConfig `json:"tls,omitempty"        structs:"tls,omitempty"        mapstructure:"tls,omitempty"`
+}
+
+// OryConfig stores the configuration of an Ory Network project.
+type OryConfig struct {
+	// ProjectURL is the base URL of the Ory Network project.
+	ProjectURL string `json:"projectURL,omitempty" structs:"projectURL,omitempty" mapstructure:"projectURL,omitempty"`
+	// APIKey is the Ory project API key sent as a bearer token on admin calls.
+	APIKey string `json:"apiKey,omitempty" structs:"apiKey,omitempty" mapstructure:"apiKey,omitempty"`
+}
+
+// HydraConfig stores the configuration of the Ory Hydra admin API used to introspect OAuth2 access tokens.
+// OAuth2 login is disabled while AdminURL is empty.
+// The plugin has no roles, so RequiredScopes and RequiredAudiences apply to every OAuth2 login on the mount.
+type HydraConfig struct {
+	AdminURL          string     `json:"adminURL,omitempty"          structs:"adminURL,omitempty"          mapstructure:"adminURL,omitempty"`
+	IntrospectionPath string     `json:"introspectionPath,omitempty" structs:"introspectionPath,omitempty" mapstructure:"introspectionPath,omitempty"`
+	RequiredScopes    []string   `json:"requiredScopes,omitempty"    structs:"requiredScopes,omitempty"    mapstructure:"requiredScopes,omitempty"`
+	RequiredAudiences []string   `json:"requiredAudiences,omitempty" structs:"requiredAudiences,omitempty" mapstructure:"requiredAudiences,omitempty"`
+	SubjectClaim      string     `json:"subjectClaim,omitempty"      structs:"subjectClaim,omitempty"      mapstructure:"subjectClaim,omitempty"`
+	TLS               *TLSConfig `json:"tls,omitempty"               structs:"tls,omitempty"               mapstructure:"tls,omitempty"`
+}
+
+// JWTConfig stores the configuration used to verify login JWTs, such as those issued by the
+// Ory Oathkeeper id_token mutator or the Kratos session tokenizer.
+// JWT login is disabled while neither JWKSURL nor PublicKeys are set.
+type JWTConfig struct {
+	JWKSURL        string        `json:"jwksURL,omitempty"        structs:"jwksURL,omitempty"        mapstructure:"jwksURL,omitempty"`
+	PublicKeys     []string      `json:"publicKeys,omitempty"     structs:"publicKeys,omitempty"     mapstructure:"publicKeys,omitempty"`
+	BoundIssuer    string        `json:"boundIssuer,omitempty"    structs:"boundIssuer,omitempty"    mapstructure:"boundIssuer,omitempty"`
+	BoundAudiences []string      `json:"boundAudiences,omitempty" structs:"boundAudiences,omitempty" mapstructure:"boundAudiences,omitempty"`
+	Leeway         time.Duration `json:"leeway"                   structs:"leeway"                   mapstructure:"leeway"`
+	SubjectClaim   string        `json:"subjectClaim,omitempty"   structs:"subjectClaim,omitempty"   mapstructure:"subjectClaim,omitempty"`
+	TLS            *TLSConfig    `json:"tls,omitempty"            structs:"tls,omitempty"            mapstructure:"tls,omitempty"`
+}
+
+// SessionCacheConfig stores the configuration of the cache of validated Kratos sessions.
+// Sessions are not cached while TTL is zero.
+type SessionCacheConfig struct {
+	Size int           `json:"size" structs:"size" mapstructure:"size"`
+	TTL  time.Duration `json:"ttl"  structs:"ttl"  mapstructure:"ttl"`
+}
+
+// CheckCacheConfig stores the configuration of the cache of Keto check results.
+// Allowed and denied results are cached for PositiveTTL and NegativeTTL, and not at all while both are zero.
+// The plugin has no roles, so checks opt out of caching by namespace, with ExemptNamespaces, rather than by role.
+type CheckCacheConfig struct {
+	Size             int           `json:"size"                       structs:"size"                       mapstructure:"size"`
+	PositiveTTL      time.Duration `json:"positiveTTL"                structs:"positiveTTL"                mapstructure:"positiveTTL"`
+	NegativeTTL      time.Duration `json:"negativeTTL"                structs:"negativeTTL"                mapstructure:"negativeTTL"`
+	ExemptNamespaces []string      `json:"exemptNamespaces,omitempty" structs:"exemptNamespaces,omitempty" mapstructure:"exemptNamespaces,omitempty"`
+}
+
+// ResilienceConfig stores the timeout, retry and circuit breaker settings of calls to Kratos and Keto.
+// The circuit breaker is disabled while BreakerThreshold is zero.
+type ResilienceConfig struct {
+	Timeout          time.Duration `json:"timeout,omitempty"         structs:"timeout,omitempty"         mapstructure:"timeout,omitempty"`
+	MaxRetries       int           `json:"maxRetries"                structs:"maxRetries"                mapstructure:"maxRetries"`
+	BreakerThreshold int           `json:"breakerThreshold"          structs:"breakerThreshold"          mapstructure:"breakerThreshold"`
+	BreakerCooldown  time.Duration `json:"breakerCooldown"           structs:"breakerCooldown"           mapstructure:"breakerCooldown"`
+}
+
+// TracingConfig stores the configuration of OpenTelemetry tracing of logins.
+// Tracing is disabled while Endpoint is empty.
+type TracingConfig struct {
+	Endpoint    string  `json:"endpoint,omitempty" structs:"endpoint,omitempty" mapstructure:"endpoint,omitempty"`
+	SampleRatio float64 `json:"sampleRatio"        structs:"sampleRatio"        mapstructure:"sampleRatio"`
+}
+
+// RateLimitConfig stores the login rate limits, in logins per minute, by client IP, session and identity.
+// A limit is disabled while it is zero. A zero burst allows as many logins at once as the limit allows per minute.
+type RateLimitConfig struct {
+	IP            int `json:"ip,omitempty"            structs:"ip,omitempty"            mapstructure:"ip,omitempty"`
+	IPBurst       int `json:"ipBurst,omitempty"       structs:"ipBurst,omitempty"       mapstructure:"ipBurst,omitempty"`
+	Session       int `json:"session,omitempty"       structs:"session,omitempty"       mapstructure:"session,omitempty"`
+	SessionBurst  int `json:"sessionBurst,omitempty"  structs:"sessionBurst,omitempty"  mapstructure:"sessionBurst,omitempty"`
+	Identity      int `json:"identity,omitempty"      structs:"identity,omitempty"      mapstructure:"identity,omitempty"`
+	IdentityBurst int `json:"identityBurst,omitempty" structs:"identityBurst,omitempty" mapstructure:"identityBurst,omitempty"`
+}
+
+// CIDRConfig stores the networks logins are accepted from and issued tokens are bound to.
+// The plugin has no roles, so the networks apply to every login on the mount.
+type CIDRConfig struct {
+	BoundCIDRs      []string `json:"boundCIDRs,omitempty"      structs:"boundCIDRs,omitempty"      mapstructure:"boundCIDRs,omitempty"`
+	TokenBoundCIDRs []string `json:"tokenBoundCIDRs,omitempty" structs:"tokenBoundCIDRs,omitempty" mapstructure:"tokenBoundCIDRs,omitempty"`
+}
+
+// tokenBoundCIDRs returns the CIDRs issued tokens are bound to,
+// which are the login bound CIDRs unless token bound CIDRs are configured.
+func (c *CIDRConfig) tokenBoundCIDRs() []string {
+	if len(c.TokenBoundCIDRs) > 0 {
+		return c.TokenBoundCIDRs
+	}
+
+	return c.BoundCIDRs
+}
+
+// AuditConfig stores the configuration of the login audit trail.
+// Login decisions are not stored while Size is zero, and are kept until overwritten while Retention is zero.
+type AuditConfig struct {
+	Size      int           `json:"size,omitempty"      structs:"size,omitempty"      mapstructure:"size,omitempty"`
+	Retention time.Duration `json:"retention,omitempty" structs:"retention,omitempty" mapstructure:"retention,omitempty"`
+}
+
+// TokenConfig stores the lifetimes of issued tokens, and the Vault API used to revoke the tokens of denied identities and sessions.
+// Tokens are not revoked by the plugin while RevocationAddress is empty, and expire once renewal is refused instead.
+// The plugin has no roles, so the lifetimes apply to every token issued by the mount.
+type TokenConfig struct {
+	TTL               time.Duration `json:"ttl"                         structs:"ttl"                         mapstructure:"ttl"`
+	MaxTTL            time.Duration `json:"maxTTL"                      structs:"maxTTL"                      mapstructure:"maxTTL"`
+	Period            time.Duration `json:"period,omitempty"            structs:"period,omitempty"            mapstructure:"period,omitempty"`
+	RevocationAddress string        `json:"revocationAddress,omitempty" structs:"revocationAddress,omitempty" mapstructure:"revocationAddress,omitempty"`
+	RevocationToken   string        `json:"revocationToken,omitempty"   structs:"revocationToken,omitempty"   mapstructure:"revocationToken,omitempty"`
+}
+
+// revocationEnabled reports whether the plugin revokes the tokens of denied identities and sessions.
+func (c *TokenConfig) revocationEnabled() bool {
+	return c.RevocationAddress != ""
 }
 
 // TransportConfig contains the transport related info,
@@ -59,6 +214,76 @@ type TransportConfig struct {
 	Schemes  []string `json:"schemes,omitempty"  structs:"schemes,omitempty"  mapstructure:"schemes,omitempty"`
 }
 
+// TLSConfig stores the TLS settings used to connect to an Ory service.
+type TLSConfig struct {
+	CACert     string `json:"caCert,omitempty"     structs:"caCert,omitempty"     mapstructure:"caCert,omitempty"`
+	ClientCert string `json:"clientCert,omitempty" structs:"clientCert,omitempty" mapstructure:"clientCert,omitempty"`
+	ClientKey  string `json:"clientKey,omitempty"  structs:"clientKey,omitempty"  mapstructure:"clientKey,omitempty"`
+	ServerName string `json:"serverName,omitempty" structs:"serverName,omitempty" mapstructure:"serverName,omitempty"`
+	SkipVerify bool   `json:"skipVerify,omitempty" structs:"skipVerify,omitempty" mapstructure:"skipVerify,omitempty"`
+}
+
+// defaultConfig returns the configuration used when none has been written.
+func defaultConfig() *Config {
+	return &Config{
+		Kratos: &KratosConfig{
+			Servers: ServerConfigurations{
+				ServerConfiguration{
+					URL:         defaultKratosPublicURL,
+					Description: "Ory Kratos Public API",
+				},
+			},
+			AdminServers: ServerConfigurations{
+				ServerConfiguration{
+					URL:         defaultKratosAdminURL,
+					Description: "Ory Kratos Admin API",
+				},
+			},
+			TLS: &TLSConfig{},
+		},
+		Keto: &KetoConfig{
+			TransportConfig: &keto.TransportConfig{
+				Host: defaultKetoReadAddress,
+			},
+			WriteAddress: defaultKetoWriteAddress,
+			TLS:          &TLSConfig{},
+		},
+		Ory: &OryConfig{},
+		Hydra: &HydraConfig{
+			IntrospectionPath: defaultHydraIntrospectionPath,
+			SubjectClaim:      hydraSubjectClaimSubject,
+			TLS:               &TLSConfig{},
+		},
+		JWT: &JWTConfig{
+			Leeway:       defaultJWTLeeway,
+			SubjectClaim: defaultJWTSubjectClaim,
+			TLS:          &TLSConfig{},
+		},
+		SessionCache: &SessionCacheConfig{
+			Size: defaultSessionCacheSize,
+		},
+		CheckCache: &CheckCacheConfig{
+			Size: defaultCheckCacheSize,
+		},
+		Resilience: &ResilienceConfig{
+			Timeout:          defaultUpstreamTimeout,
+			MaxRetries:       defaultUpstreamMaxRetries,
+			BreakerThreshold: defaultCircuitBreakerThreshold,
+			BreakerCooldown:  defaultCircuitBreakerCooldown,
+		},
+		Tracing: &TracingConfig{
+			SampleRatio: defaultTracingSampleRatio,
+		},
+		RateLimit: &RateLimitConfig{},
+		CIDR:      &CIDRConfig{},
+		Audit:     &AuditConfig{},
+		Token: &TokenConfig{
+			TTL:    defaultTokenTTL,
+			MaxTTL: defaultTokenMaxTTL,
+		},
+	}
+}
+
 // readConfig reads the configuration from the storage.
 func (b *OryAuthBackend) readConfig(ctx context.Context, s logical.Storage) (*Config, error) {
 	b.Logger().Debug("reading configuration")
@@ -79,31 +304,196 @@ func (b *OryAuthBackend) readConfig(ctx context.Context, s logical.Storage) (*Co
 
 	b.Logger().Debug("decoding entry")
 
-	config := &Config{}
+	config := defaultConfig()
 	err = entry.DecodeJSON(config)
 	if err != nil {
 		return nil, err
 	}
 
+	// Entries written before the Kratos and Keto settings were exposed store them as null.
+	defaults := defaultConfig()
+	if config.Kratos == nil {
+		config.Kratos = defaults.Kratos
+	}
+
+	if config.Keto == nil {
+		config.Keto = defaults.Keto
+	}
+
+	if config.Ory == nil {
+		config.Ory = defaults.Ory
+	}
+
+	if config.Hydra == nil {
+		config.Hydra = defaults.Hydra
+	}
+
+	if config.JWT == nil {
+		config.JWT = defaults.JWT
+	}
+
+	if config.SessionCache == nil {
+		config.SessionCache = defaults.SessionCache
+	}
+
+	if config.CheckCache == nil {
+		config.CheckCache = defaults.CheckCache
+	}
+
+	if config.Resilience == nil {
+		config.Resilience = defaults.Resilience
+	}
+
+	if config.Tracing == nil {
+		config.Tracing = defaults.Tracing
+	}
+
+	if config.RateLimit == nil {
+		config.RateLimit = defaults.RateLimit
+	}
+
+	if config.CIDR == nil {
+		config.CIDR = defaults.CIDR
+	}
+
+	if config.Audit == nil {
+		config.Audit = defaults.Audit
+	}
+
+	if config.Token == nil {
+		config.Token = defaults.Token
+	}
+
 	b.Logger().Debug("successfully decoded entry")
 
 	return config, nil
 }
 
-// configToKratosConfig converts the plugin configuration to the Kratos API client configuration.
-func configToKratosConfig(config *Config) *kratos.Configuration {
+// publicURL returns the URL of the first configured Kratos public API server.
+func (c *KratosConfig) publicURL() string {
+	if len(c.Servers) == 0 {
+		return ""
+	}
+
+	return c.Servers[0].URL
+}
+
+// adminURL returns the URL of the first configured Kratos admin API server.
+func (c *KratosConfig) adminURL() string {
+	if len(c.AdminServers) == 0 {
+		return ""
+	}
+
+	return c.AdminServers[0].URL
+}
+
+// readAddress returns the configured Keto read API gRPC address.
+func (c *KetoConfig) readAddress() string {
+	if c.TransportConfig == nil {
+		return ""
+	}
+
+	return c.TransportConfig.Host
+}
+
+// writeAddress returns the configured Keto write API gRPC address.
+func (c *KetoConfig) writeAddress() string {
+	return c.WriteAddress
+}
+
+// enabled reports whether JWT login is configured.
+func (c *JWTConfig) enabled() bool {
+	return c.JWKSURL != "" || len(c.PublicKeys) > 0
+}
+
+// tlsConfig converts the TLS settings to a crypto/tls configuration.
+func (c *TLSConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if c == nil {
+		return tlsConfig, nil
+	}
+
+	tlsConfig.ServerName = c.ServerName
+	tlsConfig.InsecureSkipVerify = c.SkipVerify
+
+	if c.CACert != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.CACert)) {
+			return nil, errors.New("failed to parse CA certificate")
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.ClientCert != "" || c.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse client certificate and key")
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// configToKratosConfig converts the plugin configuration to the configuration of a Kratos API client
+// for the given servers.
+// The Kratos client's own debug output includes cookies and tokens, so it is never enabled.
+// Instead, if debugging is configured, redacted headers are logged to the logger.
+func configToKratosConfig(config *Config, servers ServerConfigurations, logger hclog.Logger) (*kratos.Configuration, error) {
+	httpClient := config.Kratos.HTTPClient
+	if httpClient == nil {
+		tlsConfig, err := config.Kratos.TLS.tlsConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid kratos TLS configuration")
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+
+		httpClient = &http.Client{Transport: transport}
+	}
+
+	tracingClient := *httpClient
+	tracingClient.Transport = &traceContextTransport{next: httpClient.Transport}
+	httpClient = &tracingClient
+
+	if config.Kratos.Debug {
+		transport := httpClient.Transport
+		if transport == nil {
+			transport = http.DefaultTransport
+		}
+
+		debugClient := *httpClient
+		debugClient.Transport = &redactingDumpTransport{
+			next:   transport,
+			logger: logger.Named("kratos"),
+		}
+
+		httpClient = &debugClient
+	}
+
+	defaultHeader := make(map[string]string, len(config.Kratos.DefaultHeader))
+	for key, value := range config.Kratos.DefaultHeader {
+		defaultHeader[key] = value
+	}
+
 	kratosConfig := &kratos.Configuration{
 		Host:             config.Kratos.Host,
 		Scheme:           config.Kratos.Scheme,
-		DefaultHeader:    config.Kratos.DefaultHeader,
+		DefaultHeader:    defaultHeader,
 		UserAgent:        config.Kratos.UserAgent,
-		Debug:            config.Kratos.Debug,
+		Debug:            false,
 		Servers:          make(kratos.ServerConfigurations, 0),
 		OperationServers: make(map[string]kratos.ServerConfigurations, 0),
-		HTTPClient:       config.Kratos.HTTPClient,
+		HTTPClient:       httpClient,
 	}
 
-	for _, server := range config.Kratos.Servers {
+	for _, server := range servers {
 		variables := make(map[string]kratos.ServerVariable)
 
 		for _, variable := range server.Variables {
@@ -121,7 +511,7 @@ func configToKratosConfig(config *Config) *kratos.Configuration {
 		})
 	}
 
-	return kratosConfig
+	return kratosConfig, nil
 }
 
 // configToKetoConfig converts the plugin configuration to the Keto API client configuration.
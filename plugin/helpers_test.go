@@ -0,0 +1,299 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	keto "github.com/ory/keto/proto/ory/keto/relation_tuples/v1alpha2"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// configFieldData returns field data for the config path with the given raw fields.
+func configFieldData(raw map[string]interface{}) *framework.FieldData {
+	return &framework.FieldData{
+		Raw:    raw,
+		Schema: configFields,
+	}
+}
+
+// newTestBackend returns a backend set up with in-memory storage, and the storage.
+func newTestBackend(t *testing.T) (*OryAuthBackend, logical.Storage) {
+	t.Helper()
+
+	conf := logical.TestBackendConfig()
+	conf.StorageView = &logical.InmemStorage{}
+
+	return newTestBackendWithConfig(t, conf)
+}
+
+// newTestBackendWithConfig returns a backend set up with the backend configuration, and its storage.
+func newTestBackendWithConfig(t *testing.T, conf *logical.BackendConfig) (*OryAuthBackend, logical.Storage) {
+	t.Helper()
+
+	b, err := Factory(context.Background(), conf)
+	if err != nil {
+		t.Fatalf("creating backend: %v", err)
+	}
+
+	t.Cleanup(func() {
+		b.Cleanup(context.Background())
+	})
+
+	return b.(*OryAuthBackend), conf.StorageView
+}
+
+// writeTestConfig writes the configuration fields through the config path, without verifying the connection.
+func writeTestConfig(t *testing.T, b *OryAuthBackend, s logical.Storage, data map[string]interface{}) {
+	t.Helper()
+
+	data["verify_connection"] = false
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	if res != nil && res.IsError() {
+		t.Fatalf("writing config: %v", res.Error())
+	}
+}
+
+// readTestConfig reads the configuration fields through the config path.
+func readTestConfig(t *testing.T, b *OryAuthBackend, s logical.Storage) map[string]interface{} {
+	t.Helper()
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config",
+		Storage:   s,
+	})
+	if err != nil {
+		t.Fatalf("reading config: %v", err)
+	}
+
+	if res == nil || res.IsError() {
+		t.Fatalf("reading config: unexpected response %v", res)
+	}
+
+	return res.Data
+}
+
+// testKetoCheckServer is a Keto check service that allows, or denies, every check.
+type testKetoCheckServer struct {
+	keto.UnimplementedCheckServiceServer
+
+	// started, if set, receives a value whenever a check starts.
+	started chan struct{}
+
+	// proceed, if set, holds checks until it is closed.
+	proceed chan struct{}
+
+	// deny denies every check instead.
+	deny bool
+
+	// checks counts the checks made.
+	checks atomic.Int64
+}
+
+// Check answers the check once proceed is closed.
+func (s *testKetoCheckServer) Check(ctx context.Context, _ *keto.CheckRequest) (*keto.CheckResponse, error) {
+	s.checks.Add(1)
+
+	if s.started != nil {
+		s.started <- struct{}{}
+	}
+
+	if s.proceed != nil {
+		select {
+		case <-s.proceed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return &keto.CheckResponse{Allowed: !s.deny}, nil
+}
+
+// testKetoVersionServer is a Keto version service, answering the health checks of the read and write APIs.
+type testKetoVersionServer struct {
+	keto.UnimplementedVersionServiceServer
+}
+
+// GetVersion returns a fixed version.
+func (testKetoVersionServer) GetVersion(context.Context, *keto.GetVersionRequest) (*keto.GetVersionResponse, error) {
+	return &keto.GetVersionResponse{Version: "v0.10.0-alpha.0"}, nil
+}
+
+// startTestKeto serves the check service in-process, and makes the backend dial it for Keto.
+func startTestKeto(t *testing.T, b *OryAuthBackend, checkServer keto.CheckServiceServer) {
+	t.Helper()
+
+	startTestKetoServices(t, b, func(server *grpc.Server) {
+		keto.RegisterCheckServiceServer(server, checkServer)
+	})
+}
+
+// startTestKetoServices serves the services registered by register, and the version service, in-process,
+// and makes the backend dial them for both the Keto read and write APIs.
+func startTestKetoServices(t *testing.T, b *OryAuthBackend, register func(server *grpc.Server)) {
+	t.Helper()
+
+	listener := startTestKetoListener(t, register)
+
+	b.ketoDialOptions = []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+	}
+}
+
+// startTestKetoListener serves the services registered by register, and the version service, on an in-process listener.
+func startTestKetoListener(t *testing.T, register func(server *grpc.Server)) *bufconn.Listener {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+
+	server := grpc.NewServer()
+	keto.RegisterVersionServiceServer(server, testKetoVersionServer{})
+	register(server)
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	t.Cleanup(server.Stop)
+
+	return listener
+}
+
+// startTestKratos serves a Kratos public API whose whoami endpoint returns an active session of the identity,
+// and returns its URL.
+func startTestKratos(t *testing.T, identityID string) string {
+	t.Helper()
+
+	server := httptest.NewServer(testKratosSessionHandler(identityID))
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+// testKratosSessionHandler returns a handler of the Kratos whoami endpoint returning an active session of the identity.
+func testKratosSessionHandler(identityID string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sessions/whoami" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":     "session-" + identityID,
+			"active": true,
+			"identity": map[string]interface{}{
+				"id":         identityID,
+				"schema_id":  "default",
+				"schema_url": "http://localhost/schemas/default",
+				"traits":     map[string]interface{}{},
+			},
+		})
+	}
+}
+
+// startTestKratosAdmin serves a Kratos admin API whose identity endpoint returns the identity in the given state,
+// and returns its URL.
+func startTestKratosAdmin(t *testing.T, identityID string, state string) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/admin/identities/"+identityID {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":         identityID,
+			"state":      state,
+			"schema_id":  "default",
+			"schema_url": "http://localhost/schemas/default",
+			"traits":     map[string]interface{}{},
+		})
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+// testLogin logs in with a Kratos session cookie for the relation to the object.
+func testLogin(b *OryAuthBackend, s logical.Storage, object string) (*logical.Response, error) {
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "login",
+		Storage:    s,
+		Connection: &logical.Connection{RemoteAddr: "127.0.0.1"},
+		Data: map[string]interface{}{
+			"namespace":             "files",
+			"object":                object,
+			"relation":              "view",
+			"kratos_session_cookie": "ory_kratos_session=test",
+		},
+	})
+}
+
+// testCertificate returns a PEM encoded self-signed certificate and its private key.
+func testCertificate(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "vault"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshalling key: %v", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	return string(certPEM), string(keyPEM)
+}
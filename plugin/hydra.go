@@ -0,0 +1,298 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultHydraIntrospectionPath is the path of the Hydra token introspection endpoint on the admin API.
+	defaultHydraIntrospectionPath = "/admin/oauth2/introspect"
+
+	// hydraSubjectClaimSubject uses the token subject as the Keto subject.
+	hydraSubjectClaimSubject = "sub"
+
+	// hydraSubjectClaimClientID uses the token client ID as the Keto subject.
+	hydraSubjectClaimClientID = "client_id"
+)
+
+// HydraClient is a client for the Ory Hydra admin API.
+type HydraClient struct {
+	// httpClient is the HTTP client used for requests to Hydra.
+	httpClient *http.Client
+
+	// adminURL is the base URL of the Hydra admin API.
+	adminURL string
+
+	// introspectionURL is the URL of the Hydra token introspection endpoint.
+	introspectionURL string
+
+	// apiKey is the Ory API key sent as a bearer token, if any.
+	apiKey string
+
+	// policy is the timeout, retry and circuit breaker policy of introspections with Hydra.
+	policy *callPolicy
+}
+
+// hydraIntrospection is the response of the Hydra token introspection endpoint.
+type hydraIntrospection struct {
+	Active    bool     `json:"active"`
+	Subject   string   `json:"sub"`
+	ClientID  string   `json:"client_id"`
+	Scope     string   `json:"scope"`
+	Audience  []string `json:"aud"`
+	ExpiresAt int64    `json:"exp"`
+	TokenUse  string   `json:"token_use"`
+}
+
+// getHydraClient returns a client for the Ory Hydra admin API,
+// or nil if Hydra is not configured.
+func (b *OryAuthBackend) getHydraClient(
+	ctx context.Context,
+	s logical.Storage,
+) (*HydraClient, error) {
+	b.Logger().Debug("getting hydra client")
+
+	b.hydraClientMutex.RLock()
+	hydraClient := b.hydraClient
+	b.hydraClientMutex.RUnlock()
+
+	if hydraClient != nil {
+		return hydraClient, nil
+	}
+
+	b.hydraClientMutex.Lock()
+	defer b.hydraClientMutex.Unlock()
+
+	if b.hydraClient != nil {
+		return b.hydraClient, nil
+	}
+
+	config, err := b.readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	hydraClient, err = newHydraClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	b.hydraClient = hydraClient
+
+	return b.hydraClient, nil
+}
+
+// newHydraClient creates a client for the Ory Hydra admin API from the plugin configuration.
+// It returns nil if Hydra is not configured.
+func newHydraClient(config *Config) (*HydraClient, error) {
+	if config == nil || config.Hydra == nil || config.Hydra.AdminURL == "" {
+		return nil, nil
+	}
+
+	tlsConfig, err := config.Hydra.TLS.tlsConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid hydra TLS configuration")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	apiKey := ""
+	if config.Ory != nil {
+		apiKey = config.Ory.APIKey
+	}
+
+	return &HydraClient{
+		httpClient:       &http.Client{Transport: transport},
+		adminURL:         config.Hydra.AdminURL,
+		introspectionURL: config.Hydra.AdminURL + config.Hydra.IntrospectionPath,
+		apiKey:           apiKey,
+		policy:           newCallPolicy("hydra", config),
+	}, nil
+}
+
+// closeHydraClient closes the client for the Ory Hydra admin API.
+func (b *OryAuthBackend) closeHydraClient() {
+	b.hydraClientMutex.Lock()
+	defer b.hydraClientMutex.Unlock()
+
+	if b.hydraClient == nil {
+		return
+	}
+
+	b.hydraClient.httpClient.CloseIdleConnections()
+
+	b.hydraClient = nil
+}
+
+// introspectToken introspects an OAuth2 token with the Hydra admin API, under the client's call policy.
+// Failures without a response or with a 5xx response are retried, and other failures are answers of Hydra.
+func (c *HydraClient) introspectToken(ctx context.Context, token string) (*hydraIntrospection, error) {
+	form := url.Values{}
+	form.Set("token", token)
+
+	introspection := &hydraIntrospection{}
+	err := c.policy.do(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.introspectionURL, strings.NewReader(form.Encode()))
+		if err != nil {
+			return errors.Wrap(err, "failed to create hydra introspection request")
+		}
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept", "application/json")
+
+		if c.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+c.apiKey)
+		}
+
+		res, err := c.httpClient.Do(req)
+		if err != nil {
+			return &retryableError{err: errors.Wrap(err, "failed to introspect token with hydra")}
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode >= http.StatusInternalServerError {
+			return &retryableError{err: errors.Errorf("failed to introspect token with hydra: %v", res.StatusCode)}
+		}
+
+		if res.StatusCode != http.StatusOK {
+			return &upstreamAnswerError{err: errors.Errorf("failed to introspect token with hydra: %v", res.StatusCode)}
+		}
+
+		err = json.NewDecoder(res.Body).Decode(introspection)
+		if err != nil {
+			return &upstreamAnswerError{err: errors.Wrap(err, "failed to decode hydra introspection response")}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return introspection, nil
+}
+
+// checkHydraClientHealth checks the health of the Ory Hydra admin API using the given client.
+func checkHydraClientHealth(ctx context.Context, client *HydraClient) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, client.adminURL+"/health/alive", nil)
+	if err != nil {
+		return errors.Wrap(err, "hydra health check failed")
+	}
+
+	if client.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+client.apiKey)
+	}
+
+	res, err := client.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "hydra health check failed")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("hydra health check failed: %v", res.StatusCode)
+	}
+
+	return nil
+}
+
+// oauth2Principal introspects the OAuth2 access token and returns the principal it was issued to.
+// The token must be active and carry the configured scopes and audiences.
+func (b *OryAuthBackend) oauth2Principal(
+	ctx context.Context,
+	req *logical.Request,
+	token string,
+) (*loginPrincipal, error) {
+	if token == "" {
+		return nil, invalidRequestError(errors.New("missing oauth2_access_token"))
+	}
+
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := b.getHydraClient(ctx, req.Storage)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get Hydra client")
+	}
+
+	if client == nil {
+		return nil, invalidRequestError(errors.New("oauth2 login is not configured"))
+	}
+
+	introspection, err := client.introspectToken(ctx, token)
+	if err != nil {
+		b.Logger().Error("error while trying to introspect oauth2 access token", "err", err)
+
+		if isUpstreamAnswer(err) {
+			return nil, errors.Wrap(err, "could not introspect oauth2 access token")
+		}
+
+		return nil, upstreamUnavailableError(errors.Wrap(err, "could not introspect oauth2 access token"))
+	}
+
+	if !introspection.Active {
+		return nil, unauthenticatedError(errors.New("oauth2 access token is not active"))
+	}
+
+	if introspection.TokenUse != "" && introspection.TokenUse != "access_token" {
+		return nil, unauthenticatedError(errors.New("oauth2 token is not an access token"))
+	}
+
+	scopes := strings.Fields(introspection.Scope)
+	for _, scope := range config.Hydra.RequiredScopes {
+		if !containsString(scopes, scope) {
+			return nil, permissionDeniedError(errors.Errorf("oauth2 access token is missing scope %q", scope))
+		}
+	}
+
+	for _, audience := range config.Hydra.RequiredAudiences {
+		if !containsString(introspection.Audience, audience) {
+			return nil, permissionDeniedError(errors.Errorf("oauth2 access token is missing audience %q", audience))
+		}
+	}
+
+	subject := introspection.Subject
+	if config.Hydra.SubjectClaim == hydraSubjectClaimClientID {
+		subject = introspection.ClientID
+	}
+
+	if subject == "" {
+		return nil, unauthenticatedError(errors.Errorf("oauth2 access token has no %s", config.Hydra.SubjectClaim))
+	}
+
+	principal := &loginPrincipal{
+		Subject: subject,
+		Metadata: map[string]string{
+			"client_id": introspection.ClientID,
+		},
+	}
+
+	if introspection.ExpiresAt > 0 {
+		expiresAt := time.Unix(introspection.ExpiresAt, 0)
+		principal.ExpiresAt = &expiresAt
+	}
+
+	return principal, nil
+}
+
+// containsString reports whether the slice contains the value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,211 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// startTestHydra serves a Hydra admin API whose introspection endpoint returns the introspection of each known token,
+// and an inactive introspection for any other token, after failing the given number of requests with 503.
+// It returns the URL and the number of introspection requests made.
+func startTestHydra(
+	t *testing.T,
+	introspections map[string]map[string]interface{},
+	failures int64,
+) (string, *atomic.Int64) {
+	t.Helper()
+
+	requests := &atomic.Int64{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != defaultHydraIntrospectionPath {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		if requests.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		introspection, ok := introspections[r.PostFormValue("token")]
+		if !ok {
+			introspection = map[string]interface{}{"active": false}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(introspection)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server.URL, requests
+}
+
+// newTestHydraBackend returns a backend configured to log in with OAuth2 access tokens against the Hydra admin API
+// and an in-process Keto, with the given additional configuration.
+func newTestHydraBackend(t *testing.T, hydraURL string, config map[string]interface{}) (*OryAuthBackend, logical.Storage) {
+	t.Helper()
+
+	b, s := newTestBackend(t)
+	startTestKeto(t, b, &testKetoCheckServer{})
+
+	config["hydra_admin_url"] = hydraURL
+	writeTestConfig(t, b, s, config)
+
+	return b, s
+}
+
+// testOAuth2Login logs in with the OAuth2 access token for the relation to the reports object.
+func testOAuth2Login(t *testing.T, b *OryAuthBackend, s logical.Storage, token string) *logical.Response {
+	t.Helper()
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "login",
+		Storage:    s,
+		Connection: &logical.Connection{RemoteAddr: "127.0.0.1"},
+		Data: map[string]interface{}{
+			"namespace":           "files",
+			"object":              "reports",
+			"relation":            "view",
+			"oauth2_access_token": token,
+		},
+	})
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+
+	return res
+}
+
+// testIntrospections are the introspections served by the test Hydra admin API.
+var testIntrospections = map[string]map[string]interface{}{
+	"valid": {
+		"active":    true,
+		"sub":       "alice",
+		"client_id": "billing-service",
+		"scope":     "openid vault",
+		"aud":       []string{"vault"},
+		"token_use": "access_token",
+	},
+	"refresh": {
+		"active":    true,
+		"sub":       "alice",
+		"client_id": "billing-service",
+		"scope":     "vault",
+		"aud":       []string{"vault"},
+		"token_use": "refresh_token",
+	},
+	"unscoped": {
+		"active":    true,
+		"sub":       "alice",
+		"client_id": "billing-service",
+		"scope":     "openid",
+		"aud":       []string{"vault"},
+	},
+	"other-audience": {
+		"active":    true,
+		"sub":       "alice",
+		"client_id": "billing-service",
+		"scope":     "vault",
+		"aud":       []string{"billing"},
+	},
+}
+
+func TestOAuth2LoginChecksIntrospection(t *testing.T) {
+	hydraURL, _ := startTestHydra(t, testIntrospections, 0)
+	b, s := newTestHydraBackend(t, hydraURL, map[string]interface{}{
+		"hydra_required_scopes":    "vault",
+		"hydra_required_audiences": "vault",
+	})
+
+	tests := map[string]struct {
+		token  string
+		status int
+		code   string
+	}{
+		"inactive token":  {token: "revoked", status: http.StatusUnauthorized, code: loginErrorUnauthenticated},
+		"refresh token":   {token: "refresh", status: http.StatusUnauthorized, code: loginErrorUnauthenticated},
+		"missing scope":   {token: "unscoped", status: http.StatusForbidden, code: loginErrorPermissionDenied},
+		"wrong audience":  {token: "other-audience", status: http.StatusForbidden, code: loginErrorPermissionDenied},
+		"missing a token": {token: "", status: http.StatusBadRequest, code: loginErrorInvalidRequest},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			res := testOAuth2Login(t, b, s, test.token)
+			assertLoginErrorResponse(t, res, test.status, test.code)
+		})
+	}
+}
+
+func TestOAuth2LoginSubjectClaim(t *testing.T) {
+	hydraURL, _ := startTestHydra(t, testIntrospections, 0)
+
+	for claim, subject := range map[string]string{
+		hydraSubjectClaimSubject:  "alice",
+		hydraSubjectClaimClientID: "billing-service",
+	} {
+		t.Run(claim, func(t *testing.T) {
+			b, s := newTestHydraBackend(t, hydraURL, map[string]interface{}{
+				"hydra_subject_claim": claim,
+			})
+
+			res := testOAuth2Login(t, b, s, "valid")
+			if res == nil || res.Auth == nil {
+				t.Fatalf("login issued no auth: %v", res)
+			}
+
+			if got := res.Auth.InternalData["subject"]; got != subject {
+				t.Errorf("subject = %v, want %s", got, subject)
+			}
+
+			if got := res.Auth.Alias.Metadata["client_id"]; got != "billing-service" {
+				t.Errorf("client_id metadata = %q, want billing-service", got)
+			}
+		})
+	}
+}
+
+func TestOAuth2LoginRetriesUnavailableHydra(t *testing.T) {
+	hydraURL, requests := startTestHydra(t, testIntrospections, 1)
+	b, s := newTestHydraBackend(t, hydraURL, map[string]interface{}{
+		"upstream_max_retries": 1,
+	})
+
+	res := testOAuth2Login(t, b, s, "valid")
+	if res == nil || res.Auth == nil {
+		t.Fatalf("login issued no auth: %v", res)
+	}
+
+	if got := requests.Load(); got != 2 {
+		t.Errorf("%d introspection requests, want 2", got)
+	}
+}
+
+func TestOAuth2LoginFailsFastWhileHydraCircuitIsOpen(t *testing.T) {
+	hydraURL, requests := startTestHydra(t, testIntrospections, 100)
+	b, s := newTestHydraBackend(t, hydraURL, map[string]interface{}{
+		"upstream_max_retries":      0,
+		"circuit_breaker_threshold": 1,
+	})
+
+	res := testOAuth2Login(t, b, s, "valid")
+	assertLoginErrorResponse(t, res, http.StatusServiceUnavailable, loginErrorUpstreamUnavailable)
+
+	res = testOAuth2Login(t, b, s, "valid")
+	assertLoginErrorResponse(t, res, http.StatusServiceUnavailable, loginErrorUpstreamUnavailable)
+
+	if got := requests.Load(); got != 1 {
+		t.Errorf("%d introspection requests, want 1 before the circuit opened", got)
+	}
+}
@@ -0,0 +1,355 @@
+package plugin
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	// defaultJWTSubjectClaim is the JWT claim used as the Keto subject when none is configured.
+	defaultJWTSubjectClaim = "sub"
+
+	// defaultJWTLeeway is the clock skew allowed when validating JWT time claims.
+	defaultJWTLeeway = 60 * time.Second
+
+	// jwksCacheTTL is how long a fetched JWKS is used before it is fetched again.
+	jwksCacheTTL = 1 * time.Hour
+
+	// jwksMinRefreshInterval is the minimum time between JWKS fetches triggered by unknown key IDs.
+	jwksMinRefreshInterval = 10 * time.Second
+)
+
+// JWTVerifier verifies JWTs signed by Ory Oathkeeper or the Kratos session tokenizer.
+type JWTVerifier struct {
+	// config is the JWT configuration the verifier was created from.
+	config *JWTConfig
+
+	// httpClient is the HTTP client used to fetch the JWKS.
+	httpClient *http.Client
+
+	// publicKeys are the static public keys, if configured.
+	publicKeys []interface{}
+
+	// jwksMutex guards the cached JWKS.
+	jwksMutex sync.Mutex
+
+	// jwks is the cached JWKS, if a JWKS URL is configured.
+	jwks *jose.JSONWebKeySet
+
+	// jwksFetchedAt is when the cached JWKS was fetched.
+	jwksFetchedAt time.Time
+}
+
+// getJWTVerifier returns a verifier for login JWTs, or nil if JWT login is not configured.
+func (b *OryAuthBackend) getJWTVerifier(
+	ctx context.Context,
+	s logical.Storage,
+) (*JWTVerifier, error) {
+	b.Logger().Debug("getting jwt verifier")
+
+	b.jwtVerifierMutex.RLock()
+	jwtVerifier := b.jwtVerifier
+	b.jwtVerifierMutex.RUnlock()
+
+	if jwtVerifier != nil {
+		return jwtVerifier, nil
+	}
+
+	b.jwtVerifierMutex.Lock()
+	defer b.jwtVerifierMutex.Unlock()
+
+	if b.jwtVerifier != nil {
+		return b.jwtVerifier, nil
+	}
+
+	config, err := b.readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	jwtVerifier, err = newJWTVerifier(config)
+	if err != nil {
+		return nil, err
+	}
+
+	b.jwtVerifier = jwtVerifier
+
+	return b.jwtVerifier, nil
+}
+
+// newJWTVerifier creates a verifier for login JWTs from the plugin configuration.
+// It returns nil if neither a JWKS URL nor public keys are configured.
+func newJWTVerifier(config *Config) (*JWTVerifier, error) {
+	if config == nil || config.JWT == nil || !config.JWT.enabled() {
+		return nil, nil
+	}
+
+	publicKeys := make([]interface{}, 0, len(config.JWT.PublicKeys))
+	for _, publicKey := range config.JWT.PublicKeys {
+		key, err := parsePublicKeyPEM(publicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		publicKeys = append(publicKeys, key)
+	}
+
+	tlsConfig, err := config.JWT.TLS.tlsConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid jwt TLS configuration")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &JWTVerifier{
+		config:     config.JWT,
+		httpClient: &http.Client{Transport: transport},
+		publicKeys: publicKeys,
+	}, nil
+}
+
+// closeJWTVerifier closes the verifier for login JWTs.
+func (b *OryAuthBackend) closeJWTVerifier() {
+	b.jwtVerifierMutex.Lock()
+	defer b.jwtVerifierMutex.Unlock()
+
+	if b.jwtVerifier == nil {
+		return
+	}
+
+	b.jwtVerifier.httpClient.CloseIdleConnections()
+
+	b.jwtVerifier = nil
+}
+
+// verify checks the signature and claims of the JWT and returns its standard and raw claims.
+// Invalid JWTs are unauthenticated errors, and failures to fetch the JWKS upstream unavailable errors.
+func (v *JWTVerifier) verify(ctx context.Context, token string) (*jwt.Claims, map[string]interface{}, error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, nil, unauthenticatedError(errors.Wrap(err, "failed to parse jwt"))
+	}
+
+	if len(parsed.Headers) != 1 {
+		return nil, nil, unauthenticatedError(errors.New("jwt must have exactly one signature"))
+	}
+
+	keys, err := v.keys(ctx, parsed.Headers[0].KeyID)
+	if err != nil {
+		return nil, nil, upstreamUnavailableError(err)
+	}
+
+	claims := &jwt.Claims{}
+	rawClaims := map[string]interface{}{}
+
+	verified := false
+	for _, key := range keys {
+		if parsed.Claims(key, claims, &rawClaims) == nil {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		return nil, nil, unauthenticatedError(errors.New("jwt signature could not be verified"))
+	}
+
+	err = claims.ValidateWithLeeway(
+		jwt.Expected{
+			Issuer: v.config.BoundIssuer,
+			Time:   time.Now(),
+		},
+		v.config.Leeway,
+	)
+	if err != nil {
+		return nil, nil, unauthenticatedError(errors.Wrap(err, "invalid jwt"))
+	}
+
+	if claims.Expiry == nil {
+		return nil, nil, unauthenticatedError(errors.New("jwt has no expiry"))
+	}
+
+	if len(v.config.BoundAudiences) > 0 {
+		bound := false
+		for _, audience := range v.config.BoundAudiences {
+			if claims.Audience.Contains(audience) {
+				bound = true
+				break
+			}
+		}
+
+		if !bound {
+			return nil, nil, unauthenticatedError(errors.New("jwt audience does not match any of the bound audiences"))
+		}
+	}
+
+	return claims, rawClaims, nil
+}
+
+// keys returns the keys which may have signed a JWT with the given key ID.
+// The JWKS is fetched again if it is stale or does not contain the key ID.
+func (v *JWTVerifier) keys(ctx context.Context, keyID string) ([]interface{}, error) {
+	if v.config.JWKSURL == "" {
+		return v.publicKeys, nil
+	}
+
+	v.jwksMutex.Lock()
+	defer v.jwksMutex.Unlock()
+
+	stale := v.jwks == nil || time.Since(v.jwksFetchedAt) > jwksCacheTTL
+	unknown := !stale && keyID != "" && len(v.jwks.Key(keyID)) == 0
+
+	if stale || (unknown && time.Since(v.jwksFetchedAt) > jwksMinRefreshInterval) {
+		jwks, err := v.fetchJWKS(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		v.jwks = jwks
+		v.jwksFetchedAt = time.Now()
+	}
+
+	jwks := v.jwks.Keys
+	if keyID != "" {
+		jwks = v.jwks.Key(keyID)
+	}
+
+	keys := make([]interface{}, 0, len(jwks))
+	for _, key := range jwks {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		keys = append(keys, key.Public().Key)
+	}
+
+	return keys, nil
+}
+
+// fetchJWKS fetches the JWKS from the configured URL.
+func (v *JWTVerifier) fetchJWKS(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.config.JWKSURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create jwks request")
+	}
+
+	req.Header.Set("Accept", "application/json")
+
+	res, err := v.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch jwks")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("failed to fetch jwks: %v", res.StatusCode)
+	}
+
+	jwks := &jose.JSONWebKeySet{}
+	err = json.NewDecoder(res.Body).Decode(jwks)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode jwks")
+	}
+
+	return jwks, nil
+}
+
+// checkJWTVerifierHealth checks that the JWKS can be fetched, if a JWKS URL is configured.
+func checkJWTVerifierHealth(ctx context.Context, verifier *JWTVerifier) error {
+	if verifier.config.JWKSURL == "" {
+		return nil
+	}
+
+	_, err := verifier.fetchJWKS(ctx)
+
+	return err
+}
+
+// jwtPrincipal verifies the JWT and returns the principal named by its subject claim.
+func (b *OryAuthBackend) jwtPrincipal(
+	ctx context.Context,
+	req *logical.Request,
+	token string,
+) (*loginPrincipal, error) {
+	if token == "" {
+		return nil, invalidRequestError(errors.New("missing jwt"))
+	}
+
+	verifier, err := b.getJWTVerifier(ctx, req.Storage)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get JWT verifier")
+	}
+
+	if verifier == nil {
+		return nil, invalidRequestError(errors.New("jwt login is not configured"))
+	}
+
+	claims, rawClaims, err := verifier.verify(ctx, token)
+	if err != nil {
+		b.Logger().Debug("jwt verification failed", "err", err)
+		return nil, err
+	}
+
+	subject, ok := claimValue(rawClaims, verifier.config.SubjectClaim).(string)
+	if !ok || subject == "" {
+		return nil, unauthenticatedError(errors.Errorf("jwt claim %q is missing or not a string", verifier.config.SubjectClaim))
+	}
+
+	expiresAt := claims.Expiry.Time()
+
+	return &loginPrincipal{
+		Subject:   subject,
+		ExpiresAt: &expiresAt,
+		Metadata: map[string]string{
+			"issuer": claims.Issuer,
+		},
+	}, nil
+}
+
+// claimValue returns the value of a claim by its dot separated path, such as session.identity.id.
+func claimValue(claims map[string]interface{}, path string) interface{} {
+	var value interface{} = claims
+
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		value = object[key]
+	}
+
+	return value
+}
+
+// parsePublicKeyPEM parses a PEM encoded public key or certificate.
+func parsePublicKeyPEM(data string) (interface{}, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("failed to decode PEM public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err == nil {
+		return key, nil
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.New("failed to parse PEM public key")
+	}
+
+	return cert.PublicKey, nil
+}
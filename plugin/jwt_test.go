@@ -0,0 +1,312 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// testJWKS serves the public keys of its signing keys as a JWKS, and counts the fetches.
+type testJWKS struct {
+	mutex   sync.Mutex
+	keys    map[string]*ecdsa.PrivateKey
+	fetches atomic.Int64
+}
+
+// addKey generates a signing key with the key ID and adds it to the JWKS.
+func (j *testJWKS) addKey(t *testing.T, keyID string) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.keys == nil {
+		j.keys = map[string]*ecdsa.PrivateKey{}
+	}
+
+	j.keys[keyID] = key
+
+	return key
+}
+
+// ServeHTTP serves the JWKS.
+func (j *testJWKS) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	j.fetches.Add(1)
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	jwks := jose.JSONWebKeySet{}
+	for keyID, key := range j.keys {
+		jwks.Keys = append(jwks.Keys, jose.JSONWebKey{Key: &key.PublicKey, KeyID: keyID, Algorithm: string(jose.ES256), Use: "sig"})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(jwks)
+}
+
+// signTestJWT signs the claims with the key, under the key ID.
+func signTestJWT(t *testing.T, key *ecdsa.PrivateKey, keyID string, claims map[string]interface{}) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: jose.JSONWebKey{Key: key, KeyID: keyID}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		t.Fatalf("creating signer: %v", err)
+	}
+
+	token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatalf("signing jwt: %v", err)
+	}
+
+	return token
+}
+
+// testJWTClaims returns valid claims for the subject, with the given claims added or replaced.
+func testJWTClaims(subject string, overrides map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss": "https://oathkeeper.example.com",
+		"aud": []string{"vault"},
+		"sub": subject,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+
+	for key, value := range overrides {
+		claims[key] = value
+	}
+
+	return claims
+}
+
+// newTestJWTBackend returns a backend configured to verify login JWTs against the JWKS,
+// with the given additional configuration, and an in-process Keto.
+func newTestJWTBackend(t *testing.T, jwks *testJWKS, config map[string]interface{}) (*OryAuthBackend, logical.Storage) {
+	t.Helper()
+
+	server := httptest.NewServer(jwks)
+	t.Cleanup(server.Close)
+
+	b, s := newTestBackend(t)
+	startTestKeto(t, b, &testKetoCheckServer{})
+
+	config["jwt_jwks_url"] = server.URL
+	config["jwt_bound_issuer"] = "https://oathkeeper.example.com"
+	config["jwt_bound_audiences"] = "vault"
+	writeTestConfig(t, b, s, config)
+
+	return b, s
+}
+
+// verifyTestJWT verifies the JWT with the backend's verifier.
+func verifyTestJWT(t *testing.T, b *OryAuthBackend, s logical.Storage, token string) error {
+	t.Helper()
+
+	verifier, err := b.getJWTVerifier(context.Background(), s)
+	if err != nil {
+		t.Fatalf("getting verifier: %v", err)
+	}
+
+	_, _, err = verifier.verify(context.Background(), token)
+
+	return err
+}
+
+// testJWTLogin logs in with the JWT for the relation to the reports object.
+func testJWTLogin(t *testing.T, b *OryAuthBackend, s logical.Storage, token string) *logical.Response {
+	t.Helper()
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "login/jwt",
+		Storage:    s,
+		Connection: &logical.Connection{RemoteAddr: "127.0.0.1"},
+		Data: map[string]interface{}{
+			"namespace": "files",
+			"object":    "reports",
+			"relation":  "view",
+			"jwt":       token,
+		},
+	})
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+
+	return res
+}
+
+func TestJWTVerifierRejectsInvalidJWTs(t *testing.T) {
+	jwks := &testJWKS{}
+	key := jwks.addKey(t, "key-1")
+
+	b, s := newTestJWTBackend(t, jwks, map[string]interface{}{
+		"jwt_leeway": 60,
+	})
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	tests := map[string]string{
+		"bad signature":          signTestJWT(t, otherKey, "key-1", testJWTClaims("alice", nil)),
+		"wrong issuer":           signTestJWT(t, key, "key-1", testJWTClaims("alice", map[string]interface{}{"iss": "https://evil.example.com"})),
+		"wrong audience":         signTestJWT(t, key, "key-1", testJWTClaims("alice", map[string]interface{}{"aud": []string{"billing"}})),
+		"expired outside leeway": signTestJWT(t, key, "key-1", testJWTClaims("alice", map[string]interface{}{"exp": time.Now().Add(-2 * time.Minute).Unix()})),
+		"no expiry":              signTestJWT(t, key, "key-1", testJWTClaims("alice", map[string]interface{}{"exp": nil})),
+		"malformed":              "not-a-jwt",
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := verifyTestJWT(t, b, s, token)
+			if got := loginErrorCode(err); got != loginErrorUnauthenticated {
+				t.Errorf("error code = %s (%v), want %s", got, err, loginErrorUnauthenticated)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierAllowsExpiryWithinLeeway(t *testing.T) {
+	jwks := &testJWKS{}
+	key := jwks.addKey(t, "key-1")
+
+	b, s := newTestJWTBackend(t, jwks, map[string]interface{}{
+		"jwt_leeway": 60,
+	})
+
+	token := signTestJWT(t, key, "key-1", testJWTClaims("alice", map[string]interface{}{
+		"exp": time.Now().Add(-30 * time.Second).Unix(),
+	}))
+
+	err := verifyTestJWT(t, b, s, token)
+	if err != nil {
+		t.Errorf("jwt expired within the leeway was rejected: %v", err)
+	}
+}
+
+func TestJWTVerifierRefreshesJWKSForUnknownKeyID(t *testing.T) {
+	jwks := &testJWKS{}
+	key := jwks.addKey(t, "key-1")
+
+	b, s := newTestJWTBackend(t, jwks, map[string]interface{}{})
+
+	err := verifyTestJWT(t, b, s, signTestJWT(t, key, "key-1", testJWTClaims("alice", nil)))
+	if err != nil {
+		t.Fatalf("verifying jwt: %v", err)
+	}
+
+	fetches := jwks.fetches.Load()
+
+	rotatedKey := jwks.addKey(t, "key-2")
+	rotatedToken := signTestJWT(t, rotatedKey, "key-2", testJWTClaims("alice", nil))
+
+	// Unknown key IDs do not refetch the JWKS more often than the minimum refresh interval.
+	err = verifyTestJWT(t, b, s, rotatedToken)
+	if err == nil {
+		t.Fatal("jwt signed by an unknown key was verified without refreshing the jwks")
+	}
+
+	if got := jwks.fetches.Load(); got != fetches {
+		t.Errorf("jwks fetched %d times within the minimum refresh interval", got-fetches)
+	}
+
+	verifier, err := b.getJWTVerifier(context.Background(), s)
+	if err != nil {
+		t.Fatalf("getting verifier: %v", err)
+	}
+
+	verifier.jwksMutex.Lock()
+	verifier.jwksFetchedAt = time.Now().Add(-jwksMinRefreshInterval - time.Second)
+	verifier.jwksMutex.Unlock()
+
+	err = verifyTestJWT(t, b, s, rotatedToken)
+	if err != nil {
+		t.Fatalf("verifying jwt signed by the rotated key: %v", err)
+	}
+
+	if got := jwks.fetches.Load(); got != fetches+1 {
+		t.Errorf("jwks fetched %d times for the unknown key ID, want 1", got-fetches)
+	}
+}
+
+func TestJWTLoginWithDottedSubjectClaim(t *testing.T) {
+	jwks := &testJWKS{}
+	key := jwks.addKey(t, "key-1")
+
+	b, s := newTestJWTBackend(t, jwks, map[string]interface{}{
+		"jwt_subject_claim": "session.identity.id",
+	})
+
+	token := signTestJWT(t, key, "key-1", testJWTClaims("session-subject", map[string]interface{}{
+		"session": map[string]interface{}{
+			"identity": map[string]interface{}{"id": "alice"},
+		},
+	}))
+
+	res := testJWTLogin(t, b, s, token)
+	if res == nil || res.Auth == nil {
+		t.Fatalf("login issued no auth: %v", res)
+	}
+
+	if got := res.Auth.InternalData["subject"]; got != "alice" {
+		t.Errorf("subject = %v, want alice", got)
+	}
+
+	res = testJWTLogin(t, b, s, signTestJWT(t, key, "key-1", testJWTClaims("alice", nil)))
+	assertLoginErrorResponse(t, res, http.StatusUnauthorized, loginErrorUnauthenticated)
+}
+
+func TestJWTVerifierWithStaticPublicKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshalling public key: %v", err)
+	}
+
+	b, s := newTestBackend(t)
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"jwt_public_keys": []string{string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))},
+	})
+
+	err = verifyTestJWT(t, b, s, signTestJWT(t, key, "", testJWTClaims("alice", nil)))
+	if err != nil {
+		t.Errorf("verifying jwt: %v", err)
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	err = verifyTestJWT(t, b, s, signTestJWT(t, otherKey, "", testJWTClaims("alice", nil)))
+	if got := loginErrorCode(err); got != loginErrorUnauthenticated {
+		t.Errorf("error code = %s (%v), want %s", got, err, loginErrorUnauthenticated)
+	}
+}
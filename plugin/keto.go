@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"context"
+	"strings"
 
 	keto "github.com/ory/keto/proto/ory/keto/relation_tuples/v1alpha2"
 
@@ -10,9 +11,14 @@ import (
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
 // getKetoClient returns a client for the Ory Keto API.
+// The client is created on first use, with double-checked locking so concurrent callers share one client.
+// Callers must call release on the client once their requests have finished,
+// so its connections are not closed while in use.
 func (b *OryAuthBackend) getKetoClient(
 	ctx context.Context,
 	s logical.Storage,
@@ -20,61 +26,140 @@ func (b *OryAuthBackend) getKetoClient(
 	b.Logger().Debug("getting keto client")
 
 	b.ketoClientMutex.RLock()
-	defer b.ketoClientMutex.RUnlock()
-
 	if b.ketoClient != nil {
 		b.Logger().Debug("returning existing keto client")
 
+		// The client is acquired under the lock, so closeKetoClient cannot detach it in between.
+		ketoClient := b.ketoClient
+		ketoClient.inflight.Add(1)
+		b.ketoClientMutex.RUnlock()
+
+		return ketoClient, nil
+	}
+	b.ketoClientMutex.RUnlock()
+
+	b.ketoClientMutex.Lock()
+	defer b.ketoClientMutex.Unlock()
+
+	if b.ketoClient != nil {
+		b.Logger().Debug("returning keto client created concurrently")
+
+		b.ketoClient.inflight.Add(1)
+
 		return b.ketoClient, nil
 	}
 
 	b.Logger().Debug("could not find existing keto client, creating new one")
 
-	// TODO (TW) fix config
-	// b.Logger().Debug("reading config")
+	b.Logger().Debug("reading config")
 
-	// config, err := b.readConfig(ctx, s)
-	// if err != nil {
-	// 	return nil, err
-	// }
+	config, err := b.readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
 
 	b.Logger().Debug("creating keto client")
 
-	// TODO (TW) support TLS
-	// conn, err := grpc.Dial(config.Keto.TransportConfig.Host, grpc.WithInsecure())
-	conn, err := grpc.Dial("localhost:4466", grpc.WithInsecure())
+	ketoClient, err := newKetoClient(config, b.ketoDialOptions...)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to connect to keto")
+		return nil, err
 	}
 
-	b.ketoClient = &KetoClient{
-		conn:               conn,
-		CheckServiceClient: keto.NewCheckServiceClient(conn),
-	}
+	b.ketoClient = ketoClient
+	b.ketoClient.inflight.Add(1)
 
 	b.Logger().Debug("returning new keto client")
 
 	return b.ketoClient, nil
 }
 
-// closeKetoClient closes the client to the Ory Keto API.
-func (b *OryAuthBackend) closeKetoClient() {
-	b.ketoClientMutex.Lock()
-	defer b.ketoClientMutex.Unlock()
+// newKetoClient creates a client for the Ory Keto API from the plugin configuration,
+// dialled with the extra dial options in addition to those of the configuration.
+// If no configuration has been written, the default configuration is used.
+func newKetoClient(config *Config, extraDialOptions ...grpc.DialOption) (*KetoClient, error) {
+	if config == nil {
+		config = defaultConfig()
+	}
 
-	if b.ketoClient == nil {
-		return
+	transportCredentials := insecure.NewCredentials()
+	if config.Keto.TLSEnabled {
+		tlsConfig, err := config.Keto.TLS.tlsConfig()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid keto TLS configuration")
+		}
+
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+
+	dialOptions := []grpc.DialOption{
+		grpc.WithTransportCredentials(transportCredentials),
+		grpc.WithUnaryInterceptor(traceContextUnaryClientInterceptor),
 	}
 
-	if b.ketoClient.conn != nil {
-		b.ketoClient.conn.Close()
+	if config.Ory != nil && config.Ory.APIKey != "" {
+		dialOptions = append(dialOptions, grpc.WithPerRPCCredentials(&bearerTokenCredentials{
+			token: config.Ory.APIKey,
+		}))
 	}
 
-	if b.ketoClient.CheckServiceClient != nil {
-		b.ketoClient.CheckServiceClient = nil
+	dialOptions = append(dialOptions, extraDialOptions...)
+
+	readConn, err := grpc.Dial(config.Keto.readAddress(), dialOptions...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to keto read API")
 	}
 
+	writeConn, err := grpc.Dial(config.Keto.writeAddress(), dialOptions...)
+	if err != nil {
+		readConn.Close()
+
+		return nil, errors.Wrap(err, "failed to connect to keto write API")
+	}
+
+	return &KetoClient{
+		readConn:             readConn,
+		writeConn:            writeConn,
+		CheckServiceClient:   keto.NewCheckServiceClient(readConn),
+		ReadServiceClient:    keto.NewReadServiceClient(readConn),
+		ExpandServiceClient:  keto.NewExpandServiceClient(readConn),
+		VersionServiceClient: keto.NewVersionServiceClient(readConn),
+		WriteServiceClient:   keto.NewWriteServiceClient(writeConn),
+		policy:               newCallPolicy("keto", config),
+	}, nil
+}
+
+// close closes the gRPC connections of the client.
+func (c *KetoClient) close() {
+	if c.readConn != nil {
+		c.readConn.Close()
+	}
+
+	if c.writeConn != nil {
+		c.writeConn.Close()
+	}
+}
+
+// release marks a request using the client as finished.
+func (c *KetoClient) release() {
+	c.inflight.Done()
+}
+
+// closeKetoClient detaches the client to the Ory Keto API, so the next request creates a new one,
+// and closes its connections once the requests still using it have finished.
+func (b *OryAuthBackend) closeKetoClient() {
+	b.ketoClientMutex.Lock()
+	ketoClient := b.ketoClient
 	b.ketoClient = nil
+	b.ketoClientMutex.Unlock()
+
+	if ketoClient == nil {
+		return
+	}
+
+	go func() {
+		ketoClient.inflight.Wait()
+		ketoClient.close()
+	}()
 }
 
 // checkKetoHealth checks the health of the Ory Keto API.
@@ -85,13 +170,129 @@ func (b *OryAuthBackend) checkKetoHealth(ctx context.Context, s logical.Storage)
 	if err != nil {
 		return errors.Wrap(err, "failed to get keto client during health check")
 	}
+	defer ketoClient.release()
+
+	connState := ketoClient.readConn.GetState()
+	if connState != connectivity.Ready && connState != connectivity.Idle {
+		return errors.Errorf("keto read API health check failed: %v", connState)
+	}
 
-	connState := ketoClient.conn.GetState()
+	connState = ketoClient.writeConn.GetState()
 	if connState != connectivity.Ready && connState != connectivity.Idle {
-		return errors.Errorf("keto health check failed: %v", connState)
+		return errors.Errorf("keto write API health check failed: %v", connState)
 	}
 
 	b.Logger().Debug("keto health check passed")
 
 	return nil
 }
+
+// checkKetoClientHealth checks that the Ory Keto read and write APIs are reachable using the given client.
+// Unlike checkKetoHealth, this performs a round trip, as the gRPC connections are established lazily.
+func checkKetoClientHealth(ctx context.Context, client *KetoClient) error {
+	_, err := client.VersionServiceClient.GetVersion(ctx, &keto.GetVersionRequest{})
+	if err != nil {
+		return errors.Wrap(err, "keto read API health check failed")
+	}
+
+	_, err = keto.NewVersionServiceClient(client.writeConn).GetVersion(ctx, &keto.GetVersionRequest{})
+	if err != nil {
+		return errors.Wrap(err, "keto write API health check failed")
+	}
+
+	return nil
+}
+
+// parseSubject parses a Keto subject, which is either a subject ID
+// or a subject set in the format namespace:object#relation.
+func parseSubject(subject string) (*keto.Subject, error) {
+	if subject == "" {
+		return nil, errors.New("subject is empty")
+	}
+
+	if !strings.Contains(subject, "#") {
+		return keto.NewSubjectID(subject), nil
+	}
+
+	subject = strings.TrimSuffix(strings.TrimPrefix(subject, "("), ")")
+
+	namespace, rest, ok := strings.Cut(subject, ":")
+	if !ok || namespace == "" {
+		return nil, errors.Errorf("invalid subject set %q: expected namespace:object#relation", subject)
+	}
+
+	object, relation, ok := strings.Cut(rest, "#")
+	if !ok || object == "" {
+		return nil, errors.Errorf("invalid subject set %q: expected namespace:object#relation", subject)
+	}
+
+	return keto.NewSubjectSet(namespace, object, relation), nil
+}
+
+// formatSubject formats a Keto subject in the format accepted by parseSubject.
+func formatSubject(subject *keto.Subject) string {
+	if set := subject.GetSet(); set != nil {
+		if set.GetRelation() == "" {
+			return set.GetNamespace() + ":" + set.GetObject()
+		}
+
+		return set.GetNamespace() + ":" + set.GetObject() + "#" + set.GetRelation()
+	}
+
+	return subject.GetId()
+}
+
+// parseRelationTuple parses a relation tuple in the format namespace:object#relation@subject.
+func parseRelationTuple(tuple string) (*keto.RelationTuple, error) {
+	namespace, rest, ok := strings.Cut(tuple, ":")
+	if !ok || namespace == "" {
+		return nil, errors.Errorf("invalid relation tuple %q: missing namespace", tuple)
+	}
+
+	object, rest, ok := strings.Cut(rest, "#")
+	if !ok || object == "" {
+		return nil, errors.Errorf("invalid relation tuple %q: missing object", tuple)
+	}
+
+	relation, subject, ok := strings.Cut(rest, "@")
+	if !ok || relation == "" {
+		return nil, errors.Errorf("invalid relation tuple %q: missing relation", tuple)
+	}
+
+	parsedSubject, err := parseSubject(subject)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid relation tuple %q", tuple)
+	}
+
+	return &keto.RelationTuple{
+		Namespace: namespace,
+		Object:    object,
+		Relation:  relation,
+		Subject:   parsedSubject,
+	}, nil
+}
+
+// formatRelationTuple formats a relation tuple in the format accepted by parseRelationTuple.
+func formatRelationTuple(tuple *keto.RelationTuple) string {
+	return tuple.GetNamespace() + ":" + tuple.GetObject() + "#" + tuple.GetRelation() + "@" +
+		formatSubject(tuple.GetSubject())
+}
+
+// newCheckRequest returns the Keto check request for the relation tuple, evaluated with the consistency, if given.
+// The tuple is sent in the flat fields, which Keto servers before v0.10 also read.
+func newCheckRequest(tuple *keto.RelationTuple, maxDepth int32, consistency *ketoConsistency) *keto.CheckRequest {
+	checkRequest := &keto.CheckRequest{
+		Namespace: tuple.GetNamespace(),
+		Object:    tuple.GetObject(),
+		Relation:  tuple.GetRelation(),
+		Subject:   tuple.GetSubject(),
+		MaxDepth:  maxDepth,
+	}
+
+	if consistency != nil {
+		checkRequest.Latest = consistency.Latest
+		checkRequest.Snaptoken = consistency.Snaptoken
+	}
+
+	return checkRequest
+}
@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultCheckCacheSize is the maximum number of cached Keto check results when none is configured.
+	defaultCheckCacheSize = 4096
+
+	// maxCheckCachePositiveTTL is the maximum time an allowed Keto check result is cached for.
+	// The cache is node-local, and writing tuples only purges it on the node handling the write,
+	// so this bounds how long other nodes keep allowing a revoked relation.
+	maxCheckCachePositiveTTL = 5 * time.Minute
+)
+
+// CheckCache is an in-memory LRU cache of Keto check results,
+// keyed by namespace, object, relation and subject.
+type CheckCache struct {
+	// cache holds the checkCacheEntry of each cached check.
+	cache *lru.Cache
+
+	// positiveTTL is the time an allowed check is cached for.
+	positiveTTL time.Duration
+
+	// negativeTTL is the time a denied check is cached for.
+	negativeTTL time.Duration
+
+	// exemptNamespaces are the namespaces whose checks are never cached.
+	exemptNamespaces []string
+}
+
+// checkCacheEntry is a cached Keto check result.
+type checkCacheEntry struct {
+	// allowed is the result of the check.
+	allowed bool
+
+	// expiresAt is when the entry expires.
+	expiresAt time.Time
+}
+
+// ketoConsistency is the consistency a Keto check is requested with.
+// Checks with either field set are neither served from nor added to the check cache.
+type ketoConsistency struct {
+	// Latest requests that Keto evaluates the check on the latest snapshot.
+	Latest bool
+
+	// Snaptoken requests that Keto evaluates the check on a snapshot at least as fresh as the token.
+	Snaptoken string
+}
+
+// getCheckCache returns the cache of Keto check results.
+func (b *OryAuthBackend) getCheckCache(
+	ctx context.Context,
+	s logical.Storage,
+) (*CheckCache, error) {
+	b.checkCacheMutex.RLock()
+	checkCache := b.checkCache
+	b.checkCacheMutex.RUnlock()
+
+	if checkCache != nil {
+		return checkCache, nil
+	}
+
+	b.checkCacheMutex.Lock()
+	defer b.checkCacheMutex.Unlock()
+
+	if b.checkCache != nil {
+		return b.checkCache, nil
+	}
+
+	config, err := b.readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	checkCache, err = newCheckCache(config)
+	if err != nil {
+		return nil, err
+	}
+
+	b.checkCache = checkCache
+
+	return b.checkCache, nil
+}
+
+// newCheckCache creates a cache of Keto check results from the plugin configuration.
+// If check caching is disabled, the cache is empty and no check is cacheable,
+// so it is not created again for every login.
+func newCheckCache(config *Config) (*CheckCache, error) {
+	if config == nil || config.CheckCache == nil || config.CheckCache.Size <= 0 {
+		return &CheckCache{}, nil
+	}
+
+	if config.CheckCache.PositiveTTL <= 0 && config.CheckCache.NegativeTTL <= 0 {
+		return &CheckCache{}, nil
+	}
+
+	cache, err := lru.New(config.CheckCache.Size)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create check cache")
+	}
+
+	return &CheckCache{
+		cache:            cache,
+		positiveTTL:      config.CheckCache.PositiveTTL,
+		negativeTTL:      config.CheckCache.NegativeTTL,
+		exemptNamespaces: config.CheckCache.ExemptNamespaces,
+	}, nil
+}
+
+// closeCheckCache purges and drops the cache of Keto check results.
+func (b *OryAuthBackend) closeCheckCache() {
+	b.checkCacheMutex.Lock()
+	defer b.checkCacheMutex.Unlock()
+
+	if b.checkCache == nil || b.checkCache.cache == nil {
+		b.checkCache = nil
+
+		return
+	}
+
+	b.checkCache.cache.Purge()
+
+	b.checkCache = nil
+}
+
+// purgeCheckCache removes all cached Keto check results, such as after relation tuples change.
+// Only the cache of this node is purged.
+func (b *OryAuthBackend) purgeCheckCache() {
+	b.checkCacheMutex.RLock()
+	defer b.checkCacheMutex.RUnlock()
+
+	if b.checkCache == nil || b.checkCache.cache == nil {
+		return
+	}
+
+	b.checkCache.cache.Purge()
+}
+
+// cacheable reports whether a check in the namespace with the given consistency may use the cache.
+func (c *CheckCache) cacheable(namespace string, consistency *ketoConsistency) bool {
+	if c.cache == nil {
+		return false
+	}
+
+	if consistency != nil && (consistency.Latest || consistency.Snaptoken != "") {
+		return false
+	}
+
+	return !containsString(c.exemptNamespaces, namespace)
+}
+
+// get returns the cached result of the check, and whether it was cached and has not expired.
+func (c *CheckCache) get(namespace string, object string, relation string, subject string) (bool, bool) {
+	key := checkCacheKey(namespace, object, relation, subject)
+
+	val, ok := c.cache.Get(key)
+	if !ok {
+		recordCacheLookup(cacheNameCheck, false)
+
+		return false, false
+	}
+
+	entry := val.(*checkCacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		c.cache.Remove(key)
+		recordCacheLookup(cacheNameCheck, false)
+
+		return false, false
+	}
+
+	recordCacheLookup(cacheNameCheck, true)
+
+	return entry.allowed, true
+}
+
+// add caches the result of the check for the positive or negative TTL.
+func (c *CheckCache) add(namespace string, object string, relation string, subject string, allowed bool) {
+	ttl := c.negativeTTL
+	if allowed {
+		ttl = c.positiveTTL
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	c.cache.Add(checkCacheKey(namespace, object, relation, subject), &checkCacheEntry{
+		allowed:   allowed,
+		expiresAt: time.Now().Add(ttl),
+	})
+}
+
+// checkCacheKey returns the cache key of a check.
+func checkCacheKey(namespace string, object string, relation string, subject string) string {
+	return strings.Join([]string{namespace, object, relation, subject}, "\x00")
+}
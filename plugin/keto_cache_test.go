@@ -0,0 +1,210 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// newTestCheckCache returns a check cache with the TTLs and exempt namespaces.
+func newTestCheckCache(t *testing.T, positiveTTL time.Duration, negativeTTL time.Duration, exempt ...string) *CheckCache {
+	t.Helper()
+
+	checkCache, err := newCheckCache(&Config{
+		CheckCache: &CheckCacheConfig{
+			Size:             16,
+			PositiveTTL:      positiveTTL,
+			NegativeTTL:      negativeTTL,
+			ExemptNamespaces: exempt,
+		},
+	})
+	if err != nil {
+		t.Fatalf("creating check cache: %v", err)
+	}
+
+	return checkCache
+}
+
+func TestCheckCacheTTLs(t *testing.T) {
+	checkCache := newTestCheckCache(t, 30*time.Second, 5*time.Second)
+
+	checkCache.add("files", "reports", "view", "alice", true)
+	checkCache.add("files", "budgets", "view", "alice", false)
+
+	tests := []struct {
+		object string
+		ttl    time.Duration
+	}{
+		{object: "reports", ttl: 30 * time.Second},
+		{object: "budgets", ttl: 5 * time.Second},
+	}
+
+	for _, test := range tests {
+		val, ok := checkCache.cache.Peek(checkCacheKey("files", test.object, "view", "alice"))
+		if !ok {
+			t.Fatalf("check of %s was not cached", test.object)
+		}
+
+		ttl := time.Until(val.(*checkCacheEntry).expiresAt)
+		if ttl <= test.ttl-time.Second || ttl > test.ttl {
+			t.Errorf("check of %s is cached for %s, want %s", test.object, ttl, test.ttl)
+		}
+	}
+
+	if allowed, ok := checkCache.get("files", "budgets", "view", "alice"); !ok || allowed {
+		t.Errorf("denied check = (%t, %t), want (false, true)", allowed, ok)
+	}
+
+	checkCache.cache.Add(checkCacheKey("files", "stale", "view", "alice"), &checkCacheEntry{
+		allowed:   true,
+		expiresAt: time.Now().Add(-time.Millisecond),
+	})
+
+	if _, ok := checkCache.get("files", "stale", "view", "alice"); ok {
+		t.Error("expired check was returned")
+	}
+}
+
+func TestCheckCacheWithoutNegativeTTLOnlyCachesAllowedChecks(t *testing.T) {
+	checkCache := newTestCheckCache(t, 30*time.Second, 0)
+
+	checkCache.add("files", "reports", "view", "alice", true)
+	checkCache.add("files", "budgets", "view", "alice", false)
+
+	if _, ok := checkCache.get("files", "reports", "view", "alice"); !ok {
+		t.Error("allowed check was not cached")
+	}
+
+	if _, ok := checkCache.get("files", "budgets", "view", "alice"); ok {
+		t.Error("denied check was cached without a negative TTL")
+	}
+}
+
+func TestCheckCacheCacheable(t *testing.T) {
+	checkCache := newTestCheckCache(t, 30*time.Second, 5*time.Second, "admin")
+
+	tests := []struct {
+		name        string
+		namespace   string
+		consistency *ketoConsistency
+		cacheable   bool
+	}{
+		{name: "default", namespace: "files", consistency: &ketoConsistency{}, cacheable: true},
+		{name: "exempt namespace", namespace: "admin", consistency: &ketoConsistency{}, cacheable: false},
+		{name: "latest", namespace: "files", consistency: &ketoConsistency{Latest: true}, cacheable: false},
+		{name: "snaptoken", namespace: "files", consistency: &ketoConsistency{Snaptoken: "token"}, cacheable: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := checkCache.cacheable(test.namespace, test.consistency); got != test.cacheable {
+				t.Errorf("cacheable = %t, want %t", got, test.cacheable)
+			}
+		})
+	}
+
+	if newTestCheckCache(t, 0, 0).cacheable("files", nil) {
+		t.Error("check is cacheable with both TTLs disabled")
+	}
+}
+
+func TestLoginCachesChecks(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		checks int64
+	}{
+		"cached": {
+			config: map[string]interface{}{"check_cache_positive_ttl": 30},
+			checks: 1,
+		},
+		"exempt namespace": {
+			config: map[string]interface{}{"check_cache_positive_ttl": 30, "check_cache_exempt_namespaces": "files"},
+			checks: 2,
+		},
+		"disabled": {
+			config: map[string]interface{}{},
+			checks: 2,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			checkServer := &testKetoCheckServer{}
+			b, s := newTestLoginBackend(t, checkServer)
+			writeTestConfig(t, b, s, test.config)
+
+			for i := 0; i < 2; i++ {
+				res, err := testLogin(b, s, "reports")
+				if err != nil || res == nil || res.Auth == nil {
+					t.Fatalf("logging in: %v %v", res, err)
+				}
+			}
+
+			if got := checkServer.checks.Load(); got != test.checks {
+				t.Errorf("%d keto checks for two logins, want %d", got, test.checks)
+			}
+		})
+	}
+}
+
+func TestTupleWritesPurgeCheckCache(t *testing.T) {
+	b, s, _ := newTestTupleBackend(t)
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"check_cache_positive_ttl": 300,
+		"check_cache_negative_ttl": 300,
+	})
+
+	allowed := func() bool {
+		t.Helper()
+
+		res, err := testLogin(b, s, "reports")
+		if err != nil {
+			t.Fatalf("logging in: %v", err)
+		}
+
+		return res != nil && res.Auth != nil
+	}
+
+	if allowed() {
+		t.Fatal("login allowed before the tuple was written")
+	}
+
+	ketoTuplesRequest(t, b, s, logical.UpdateOperation, map[string]interface{}{
+		"tuple": "files:reports#view@alice",
+	})
+
+	if !allowed() {
+		t.Fatal("cached denial was not purged by the tuple write")
+	}
+
+	ketoTuplesRequest(t, b, s, logical.DeleteOperation, map[string]interface{}{
+		"tuple": "files:reports#view@alice",
+	})
+
+	if allowed() {
+		t.Error("cached allowance was not purged by the tuple delete")
+	}
+}
+
+func TestConfigRejectsLongPositiveCheckCacheTTL(t *testing.T) {
+	b, s := newTestBackend(t)
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"check_cache_positive_ttl": "10m",
+			"verify_connection":        false,
+		},
+	})
+	if err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	if res == nil || !res.IsError() {
+		t.Errorf("positive TTL above %s accepted: %v", maxCheckCachePositiveTTL, res)
+	}
+}
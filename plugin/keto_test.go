@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	keto "github.com/ory/keto/proto/ory/keto/relation_tuples/v1alpha2"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestNewCheckRequest(t *testing.T) {
+	tuple := &keto.RelationTuple{
+		Namespace: "files",
+		Object:    "reports",
+		Relation:  "view",
+		Subject:   keto.NewSubjectID("alice"),
+	}
+
+	checkRequest := newCheckRequest(tuple, 3, &ketoConsistency{Latest: true, Snaptoken: "token"})
+
+	if checkRequest.GetNamespace() != "files" || checkRequest.GetObject() != "reports" || checkRequest.GetRelation() != "view" {
+		t.Errorf("unexpected check request tuple: %v", checkRequest)
+	}
+
+	if formatSubject(checkRequest.GetSubject()) != "alice" {
+		t.Errorf("expected subject alice, got %q", formatSubject(checkRequest.GetSubject()))
+	}
+
+	if checkRequest.GetMaxDepth() != 3 || !checkRequest.GetLatest() || checkRequest.GetSnaptoken() != "token" {
+		t.Errorf("unexpected check request options: %v", checkRequest)
+	}
+
+	checkRequest = newCheckRequest(tuple, 0, nil)
+	if checkRequest.GetLatest() || checkRequest.GetSnaptoken() != "" {
+		t.Errorf("expected no consistency without one given, got %v", checkRequest)
+	}
+}
+
+func TestKetoClientUsesSeparateReadAndWriteAddresses(t *testing.T) {
+	readListener := startTestKetoListener(t, func(server *grpc.Server) {
+		keto.RegisterCheckServiceServer(server, &testKetoCheckServer{})
+	})
+	writeListener := startTestKetoListener(t, func(*grpc.Server) {})
+
+	listeners := map[string]*bufconn.Listener{
+		"keto-read:4466":  readListener,
+		"keto-write:4467": writeListener,
+	}
+
+	b, s := newTestBackend(t)
+	b.ketoDialOptions = []grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, address string) (net.Conn, error) {
+			listener, ok := listeners[address]
+			if !ok {
+				return nil, errors.Errorf("unexpected address %q", address)
+			}
+
+			return listener.DialContext(ctx)
+		}),
+	}
+
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"keto_read_address":  "keto-read:4466",
+		"keto_write_address": "keto-write:4467",
+	})
+
+	data := readTestConfig(t, b, s)
+	if data["keto_read_address"] != "keto-read:4466" || data["keto_write_address"] != "keto-write:4467" {
+		t.Errorf("unexpected keto addresses on read: %v, %v", data["keto_read_address"], data["keto_write_address"])
+	}
+
+	client, err := b.getKetoClient(context.Background(), s)
+	if err != nil {
+		t.Fatalf("getting keto client: %v", err)
+	}
+	defer client.release()
+
+	if got := client.readConn.Target(); got != "keto-read:4466" {
+		t.Errorf("read connection target = %q, want keto-read:4466", got)
+	}
+
+	if got := client.writeConn.Target(); got != "keto-write:4467" {
+		t.Errorf("write connection target = %q, want keto-write:4467", got)
+	}
+
+	err = checkKetoClientHealth(context.Background(), client)
+	if err != nil {
+		t.Fatalf("checking health: %v", err)
+	}
+
+	// Only the read API serves checks, so a check succeeds only if it is sent on the read connection.
+	res, err := client.CheckServiceClient.Check(context.Background(), &keto.CheckRequest{
+		Namespace: "files",
+		Object:    "reports",
+		Relation:  "view",
+		Subject:   keto.NewSubjectID("alice"),
+	})
+	if err != nil {
+		t.Fatalf("checking: %v", err)
+	}
+
+	if !res.GetAllowed() {
+		t.Error("check was not allowed")
+	}
+}
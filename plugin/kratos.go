@@ -4,24 +4,36 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/logical"
 	kratos "github.com/ory/kratos-client-go"
 	"github.com/pkg/errors"
 )
 
 // getKratosClient returns a client for the Ory Kratos API.
+// The client is created on first use, with double-checked locking so concurrent callers share one client.
 func (b *OryAuthBackend) getKratosClient(
 	ctx context.Context,
 	s logical.Storage,
-) (*kratos.APIClient, error) {
+) (*KratosClient, error) {
 	b.Logger().Debug("getting kratos client")
 
 	b.kratosClientMutex.RLock()
-	defer b.kratosClientMutex.RUnlock()
+	kratosClient := b.kratosClient
+	b.kratosClientMutex.RUnlock()
 
-	if b.kratosClient != nil {
+	if kratosClient != nil {
 		b.Logger().Debug("returning existing kratos client")
 
+		return kratosClient, nil
+	}
+
+	b.kratosClientMutex.Lock()
+	defer b.kratosClientMutex.Unlock()
+
+	if b.kratosClient != nil {
+		b.Logger().Debug("returning kratos client created concurrently")
+
 		return b.kratosClient, nil
 	}
 
@@ -29,35 +41,58 @@ func (b *OryAuthBackend) getKratosClient(
 
 	b.Logger().Debug("reading config")
 
-	// TODO (TW) fix config
-	// config, err := b.readConfig(ctx, s)
-	// if err != nil {
-	// 	b.Logger().Error("failed to read config", "error", err)
+	config, err := b.readConfig(ctx, s)
+	if err != nil {
+		b.Logger().Error("failed to read config", "error", err)
 
-	// 	return nil, err
-	// }
-	// kratosConfig := configToKratosConfig(config)
+		return nil, err
+	}
 
 	b.Logger().Debug("creating kratos client")
 
-	kratosConfig := kratos.NewConfiguration()
-	kratosConfig.Debug = true
-	kratosConfig.Servers = kratos.ServerConfigurations{
-		kratos.ServerConfiguration{
-			URL:         "https://localhost:4433",
-			Description: "Ory Kratos",
-			Variables:   map[string]kratos.ServerVariable{},
-		},
+	kratosClient, err = newKratosClient(config, b.Logger())
+	if err != nil {
+		return nil, err
 	}
-	kratosConfig.HTTPClient = &http.Client{}
 
-	b.kratosClient = kratos.NewAPIClient(kratosConfig)
+	b.kratosClient = kratosClient
 
-	b.Logger().Debug("returning new kratos client", "url", kratosConfig.Servers[0].URL)
+	b.Logger().Debug("returning new kratos client")
 
 	return b.kratosClient, nil
 }
 
+// newKratosClient creates clients for the Ory Kratos public and admin APIs from the plugin configuration.
+// If Kratos debugging is enabled, redacted request and response headers are logged to the logger.
+// If no configuration has been written, the default configuration is used.
+func newKratosClient(config *Config, logger hclog.Logger) (*KratosClient, error) {
+	if config == nil {
+		config = defaultConfig()
+	}
+
+	publicConfig, err := configToKratosConfig(config, config.Kratos.Servers, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	adminConfig, err := configToKratosConfig(config, config.Kratos.AdminServers, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	// Kratos treats a bearer token on the public API as a session token,
+	// so the Ory API key is only sent to the admin API.
+	if config.Ory != nil && config.Ory.APIKey != "" {
+		adminConfig.DefaultHeader["Authorization"] = "Bearer " + config.Ory.APIKey
+	}
+
+	return &KratosClient{
+		PublicClient: kratos.NewAPIClient(publicConfig),
+		AdminClient:  kratos.NewAPIClient(adminConfig),
+		policy:       newCallPolicy("kratos", config),
+	}, nil
+}
+
 // closeKratosClient closes the client for the Ory Kratos API.
 func (b *OryAuthBackend) closeKratosClient() {
 	b.Logger().Debug("closing kratos client")
@@ -83,17 +118,87 @@ func (b *OryAuthBackend) checkKratosHealth(ctx context.Context, s logical.Storag
 		return errors.Wrap(err, "failed to get kratos client during health check")
 	}
 
-	_, res, err := kratosClient.MetadataApi.IsAliveExecute(
-		kratos.MetadataApiApiIsAliveRequest{},
-	)
+	err = checkKratosClientHealth(ctx, kratosClient)
+	if err != nil {
+		return err
+	}
+
+	b.Logger().Debug("kratos health check passed")
+
+	return nil
+}
+
+// checkKratosClientHealth checks the health of the Ory Kratos public and admin APIs using the given client.
+func checkKratosClientHealth(ctx context.Context, client *KratosClient) error {
+	_, res, err := client.PublicClient.MetadataApi.IsAlive(ctx).Execute()
 	if err != nil {
-		return errors.Wrap(err, "kratos health check failed")
+		return errors.Wrap(err, "kratos public API health check failed")
 	}
 	if res.StatusCode != http.StatusOK {
-		return errors.Errorf("kratos health check failed: %v", res.StatusCode)
+		return errors.Errorf("kratos public API health check failed: %v", res.StatusCode)
 	}
 
-	b.Logger().Debug("kratos health check passed")
+	_, res, err = client.AdminClient.MetadataApi.IsAlive(ctx).Execute()
+	if err != nil {
+		return errors.Wrap(err, "kratos admin API health check failed")
+	}
+	if res.StatusCode != http.StatusOK {
+		return errors.Errorf("kratos admin API health check failed: %v", res.StatusCode)
+	}
 
 	return nil
 }
+
+// getKratosIdentity returns the active Kratos identity with the given ID using the admin API.
+func (b *OryAuthBackend) getKratosIdentity(
+	ctx context.Context,
+	s logical.Storage,
+	identityID string,
+) (*kratos.Identity, error) {
+	b.Logger().Debug("getting kratos identity", "identity_id", identityID)
+
+	client, err := b.getKratosClient(ctx, s)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get Kratos client")
+	}
+
+	var identity *kratos.Identity
+	var res *http.Response
+	err = client.policy.do(ctx, func(ctx context.Context) error {
+		var err error
+		identity, res, err = client.AdminClient.V0alpha2Api.AdminGetIdentity(ctx, identityID).Execute()
+
+		return kratosCallError(res, err)
+	})
+	if err != nil {
+		if res != nil && res.StatusCode == http.StatusNotFound {
+			return nil, unauthenticatedError(errors.Errorf("kratos identity %q not found", identityID))
+		}
+
+		if res == nil || res.StatusCode >= http.StatusInternalServerError {
+			return nil, upstreamUnavailableError(errors.Wrap(err, "failed to get kratos identity"))
+		}
+
+		return nil, errors.Wrap(err, "failed to get kratos identity")
+	}
+
+	if identity.State != nil && *identity.State != kratos.IDENTITYSTATE_ACTIVE {
+		return nil, unauthenticatedError(errors.Errorf("kratos identity %q is not active", identityID))
+	}
+
+	return identity, nil
+}
+
+// kratosCallError marks the error of a Kratos API call made under a call policy:
+// failures without a response or with a 5xx response are retryable, and other failures are answers of Kratos.
+func kratosCallError(res *http.Response, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if res == nil || res.StatusCode >= http.StatusInternalServerError {
+		return &retryableError{err: err}
+	}
+
+	return &upstreamAnswerError{err: err}
+}
@@ -0,0 +1,60 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+)
+
+func TestKratosUsesPublicAndAdminEndpoints(t *testing.T) {
+	b, s := newTestBackend(t)
+	startTestKeto(t, b, &testKetoCheckServer{})
+
+	// Each server only answers the calls of its own API.
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"kratos_public_url": startTestKratos(t, "alice"),
+		"kratos_admin_url":  startTestKratosAdmin(t, "alice", "active"),
+	})
+
+	res, err := testLogin(b, s, "reports")
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+
+	if res == nil || res.Auth == nil {
+		t.Fatalf("login issued no auth: %v", res)
+	}
+
+	identity, err := b.getKratosIdentity(context.Background(), s, "alice")
+	if err != nil {
+		t.Fatalf("getting identity: %v", err)
+	}
+
+	if identity.Id != "alice" {
+		t.Errorf("identity id = %q, want alice", identity.Id)
+	}
+}
+
+func TestGetKratosIdentityRejectsUnknownAndInactiveIdentities(t *testing.T) {
+	tests := map[string]struct {
+		identityID string
+		state      string
+	}{
+		"unknown":  {identityID: "bob", state: "active"},
+		"inactive": {identityID: "alice", state: "inactive"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, s := newTestBackend(t)
+
+			writeTestConfig(t, b, s, map[string]interface{}{
+				"kratos_admin_url": startTestKratosAdmin(t, "alice", test.state),
+			})
+
+			_, err := b.getKratosIdentity(context.Background(), s, test.identityID)
+			if got := loginErrorCode(err); got != loginErrorUnauthenticated {
+				t.Errorf("error code = %s (%v), want %s", got, err, loginErrorUnauthenticated)
+			}
+		})
+	}
+}
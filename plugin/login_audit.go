@@ -0,0 +1,286 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+)
+
+const (
+	// loginAuditStoragePrefix is the storage prefix of login audit records, keyed by their slot in the ring buffer.
+	loginAuditStoragePrefix = "audit/logins/"
+
+	// loginAuditHeadStorageKey is the storage key of the sequence number of the next login audit record.
+	loginAuditHeadStorageKey = "audit/head"
+
+	// loginAuditRate is the number of login audit records written per second, after a burst of loginAuditBurst.
+	// Decisions over the rate are not stored, so a flood of logins cannot flood the storage.
+	loginAuditRate = 100
+
+	// loginAuditBurst is the number of login audit records written at once.
+	loginAuditBurst = 200
+)
+
+// loginAuditRecord is a login decision stored in the login audit trail.
+type loginAuditRecord struct {
+	Sequence   uint64    `json:"sequence"`
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	IdentityID string    `json:"identity_id,omitempty"`
+	Policy     string    `json:"policy,omitempty"`
+	Check      string    `json:"check,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Reason     string    `json:"reason,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+}
+
+// loginAuditHead is the head of the login audit ring buffer.
+type loginAuditHead struct {
+	// Next is the sequence number of the next login audit record.
+	Next uint64 `json:"next"`
+}
+
+// auditLogin stores the login decision in the login audit trail, if it is enabled.
+// Every decision is stored, including malformed logins and logins rejected by a bound CIDR or rate limit,
+// as long as the audit write rate allows it.
+// Logins are not failed if the decision cannot be stored, and decisions are not stored on performance standbys.
+func (b *OryAuthBackend) auditLogin(
+	ctx context.Context,
+	req *logical.Request,
+	config *Config,
+	method string,
+	namespace string,
+	object string,
+	relation string,
+	principal *loginPrincipal,
+	err error,
+) {
+	if config == nil || config.Audit == nil || config.Audit.Size <= 0 {
+		return
+	}
+
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return
+	}
+
+	if !b.loginAuditLimiter.Allow() {
+		recordLoginAuditDropped(req)
+
+		return
+	}
+
+	record := &loginAuditRecord{
+		Time:       time.Now().UTC(),
+		Method:     method,
+		Outcome:    loginOutcomeSuccess,
+		RemoteAddr: clientIP(req),
+	}
+
+	if namespace != "" && object != "" && relation != "" {
+		record.Policy = strings.Join([]string{namespace, relation}, "_")
+		record.Check = fmt.Sprintf("%s:%s#%s", namespace, object, relation)
+	}
+
+	if principal != nil {
+		record.IdentityID = principal.Subject
+	}
+
+	if err != nil {
+		record.Outcome = loginErrorCode(err)
+		record.Reason = err.Error()
+	}
+
+	writeErr := b.appendLoginAuditRecord(ctx, req.Storage, config.Audit.Size, record)
+	if writeErr != nil {
+		b.Logger().Warn("failed to store login audit record", "err", writeErr)
+	}
+}
+
+// appendLoginAuditRecord stores the record in the next slot of the ring buffer, overwriting the oldest record once it is full,
+// and then advances the stored head past it.
+// Each record takes its own slot from the in-memory sequence, so concurrent logins write different keys.
+func (b *OryAuthBackend) appendLoginAuditRecord(
+	ctx context.Context,
+	s logical.Storage,
+	size int,
+	record *loginAuditRecord,
+) error {
+	sequence, err := b.nextLoginAuditSequence(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	record.Sequence = sequence
+
+	entry, err := logical.StorageEntryJSON(loginAuditStorageKey(record.Sequence%uint64(size)), record)
+	if err != nil {
+		return err
+	}
+
+	err = s.Put(ctx, entry)
+	if err != nil {
+		return errors.Wrap(err, "failed to write login audit record")
+	}
+
+	return b.advanceLoginAuditHead(ctx, s, sequence+1)
+}
+
+// nextLoginAuditSequence returns the sequence number of the next login audit record.
+// The sequence is loaded from the stored head once, and then kept in memory.
+func (b *OryAuthBackend) nextLoginAuditSequence(ctx context.Context, s logical.Storage) (uint64, error) {
+	if !b.loginAuditLoaded.Load() {
+		b.loginAuditMutex.Lock()
+		defer b.loginAuditMutex.Unlock()
+
+		if !b.loginAuditLoaded.Load() {
+			next, err := readLoginAuditHead(ctx, s)
+			if err != nil {
+				return 0, err
+			}
+
+			b.loginAuditHead = next
+			b.loginAuditSequence.Store(next)
+			b.loginAuditLoaded.Store(true)
+		}
+	}
+
+	return b.loginAuditSequence.Add(1) - 1, nil
+}
+
+// advanceLoginAuditHead stores next as the head of the ring buffer, unless a later head was already stored.
+func (b *OryAuthBackend) advanceLoginAuditHead(ctx context.Context, s logical.Storage, next uint64) error {
+	b.loginAuditMutex.Lock()
+	defer b.loginAuditMutex.Unlock()
+
+	if next <= b.loginAuditHead {
+		return nil
+	}
+
+	entry, err := logical.StorageEntryJSON(loginAuditHeadStorageKey, &loginAuditHead{Next: next})
+	if err != nil {
+		return err
+	}
+
+	err = s.Put(ctx, entry)
+	if err != nil {
+		return errors.Wrap(err, "failed to write login audit head")
+	}
+
+	b.loginAuditHead = next
+
+	return nil
+}
+
+// resetLoginAuditSequence drops the in-memory sequence, so it is loaded from the stored head again,
+// such as after another node stored login audit records.
+func (b *OryAuthBackend) resetLoginAuditSequence() {
+	b.loginAuditMutex.Lock()
+	defer b.loginAuditMutex.Unlock()
+
+	b.loginAuditLoaded.Store(false)
+}
+
+// readLoginAuditHead returns the sequence number of the next login audit record, or 0 if none was stored.
+func readLoginAuditHead(ctx context.Context, s logical.Storage) (uint64, error) {
+	entry, err := s.Get(ctx, loginAuditHeadStorageKey)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read login audit head")
+	}
+
+	if entry == nil {
+		return 0, nil
+	}
+
+	head := &loginAuditHead{}
+	err = entry.DecodeJSON(head)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to decode login audit head")
+	}
+
+	return head.Next, nil
+}
+
+// readLoginAuditRecord returns the login audit record with the sequence number,
+// or nil if it was deleted or overwritten by a later record.
+func readLoginAuditRecord(ctx context.Context, s logical.Storage, size int, sequence uint64) (*loginAuditRecord, error) {
+	entry, err := s.Get(ctx, loginAuditStorageKey(sequence%uint64(size)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read login audit record")
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	record := &loginAuditRecord{}
+	err = entry.DecodeJSON(record)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode login audit record")
+	}
+
+	if record.Sequence != sequence {
+		return nil, nil
+	}
+
+	return record, nil
+}
+
+// cleanupLoginAudit deletes login audit records older than the retention,
+// and records in slots beyond the ring buffer size, such as after it was reduced.
+func (b *OryAuthBackend) cleanupLoginAudit(ctx context.Context, s logical.Storage) error {
+	config, err := b.readConfig(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	if config == nil {
+		config = defaultConfig()
+	}
+
+	keys, err := s.List(ctx, loginAuditStoragePrefix)
+	if err != nil {
+		return errors.Wrap(err, "failed to list login audit records")
+	}
+
+	for _, key := range keys {
+		slot, err := strconv.Atoi(key)
+		if err == nil && slot < config.Audit.Size {
+			if config.Audit.Retention <= 0 {
+				continue
+			}
+
+			entry, err := s.Get(ctx, loginAuditStoragePrefix+key)
+			if err != nil {
+				return errors.Wrap(err, "failed to read login audit record")
+			}
+
+			if entry == nil {
+				continue
+			}
+
+			record := &loginAuditRecord{}
+			err = entry.DecodeJSON(record)
+			if err == nil && time.Since(record.Time) <= config.Audit.Retention {
+				continue
+			}
+		}
+
+		err = s.Delete(ctx, loginAuditStoragePrefix+key)
+		if err != nil {
+			return errors.Wrap(err, "failed to delete login audit record")
+		}
+	}
+
+	return nil
+}
+
+// loginAuditStorageKey returns the storage key of a slot of the login audit ring buffer.
+func loginAuditStorageKey(slot uint64) string {
+	return loginAuditStoragePrefix + strconv.FormatUint(slot, 10)
+}
@@ -0,0 +1,184 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/time/rate"
+)
+
+// readTestLoginAudit reads the login audit trail with the filters, and returns the response data.
+func readTestLoginAudit(
+	t *testing.T,
+	b *OryAuthBackend,
+	s logical.Storage,
+	data map[string]interface{},
+) map[string]interface{} {
+	t.Helper()
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "audit/logins",
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("reading login audit trail: %v", err)
+	}
+
+	if res == nil || res.IsError() {
+		t.Fatalf("reading login audit trail: %v", res)
+	}
+
+	return res.Data
+}
+
+// testLoginAuditOutcomes returns the outcomes of the logins in the login audit trail, newest first.
+func testLoginAuditOutcomes(data map[string]interface{}) []string {
+	outcomes := []string{}
+	for _, login := range data["logins"].([]map[string]interface{}) {
+		outcomes = append(outcomes, login["outcome"].(string))
+	}
+
+	return outcomes
+}
+
+func TestLoginAuditRecordsAllDecisions(t *testing.T) {
+	b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"audit_log_size":      16,
+		"bound_cidrs":         "10.0.0.0/8",
+		"rate_limit_ip":       1,
+		"rate_limit_ip_burst": 1,
+	})
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "login",
+		Storage:    s,
+		Connection: &logical.Connection{RemoteAddr: "10.0.0.1:1234"},
+		Data:       map[string]interface{}{"kratos_session_cookie": "cookie"},
+	})
+	if err != nil {
+		t.Fatalf("malformed login: %v", err)
+	}
+
+	testRateLimitedLogin(t, b, s, "192.168.1.1:1234", "cookie")
+	testRateLimitedLogin(t, b, s, "10.0.0.1:1234", "cookie")
+	testRateLimitedLogin(t, b, s, "10.0.0.1:1234", "cookie")
+
+	data := readTestLoginAudit(t, b, s, nil)
+
+	got := testLoginAuditOutcomes(data)
+	want := []string{loginErrorRateLimited, loginOutcomeSuccess, loginErrorPermissionDenied, loginErrorInvalidRequest}
+	if len(got) != len(want) {
+		t.Fatalf("outcomes = %v, want %v", got, want)
+	}
+
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("outcomes = %v, want %v", got, want)
+		}
+	}
+
+	logins := data["logins"].([]map[string]interface{})
+	if logins[1]["identity_id"] != "alice" || logins[1]["policy"] != "files_view" || logins[1]["check"] != "files:reports#view" {
+		t.Errorf("unexpected successful login %v", logins[1])
+	}
+
+	if logins[3]["check"] != "" || logins[3]["reason"] == "" {
+		t.Errorf("unexpected malformed login %v", logins[3])
+	}
+
+	if _, ok := data["next_before"]; ok {
+		t.Errorf("expected no next_before once the whole trail is read, got %v", data["next_before"])
+	}
+}
+
+func TestLoginAuditWriteRateLimit(t *testing.T) {
+	b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"audit_log_size": 16,
+	})
+
+	b.loginAuditLimiter = rate.NewLimiter(rate.Every(time.Hour), 2)
+
+	for i := 0; i < 4; i++ {
+		testRateLimitedLogin(t, b, s, "10.0.0.1:1234", "cookie")
+	}
+
+	if got := testLoginAuditOutcomes(readTestLoginAudit(t, b, s, nil)); len(got) != 2 {
+		t.Errorf("stored %d records over the write rate, want 2", len(got))
+	}
+}
+
+func TestLoginAuditPaging(t *testing.T) {
+	b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"audit_log_size": 4,
+	})
+
+	for i := 0; i < 6; i++ {
+		testRateLimitedLogin(t, b, s, "10.0.0.1:1234", "cookie")
+	}
+
+	data := readTestLoginAudit(t, b, s, map[string]interface{}{"limit": 3})
+
+	logins := data["logins"].([]map[string]interface{})
+	if len(logins) != 3 || logins[0]["sequence"] != uint64(5) || logins[2]["sequence"] != uint64(3) {
+		t.Fatalf("unexpected first page %v", logins)
+	}
+
+	data = readTestLoginAudit(t, b, s, map[string]interface{}{"limit": 3, "before": data["next_before"]})
+
+	// The ring buffer holds the four latest records, so the second page ends with the oldest one kept.
+	logins = data["logins"].([]map[string]interface{})
+	if len(logins) != 1 || logins[0]["sequence"] != uint64(2) {
+		t.Fatalf("unexpected second page %v", logins)
+	}
+
+	if _, ok := data["next_before"]; ok {
+		t.Errorf("expected no next_before on the last page, got %v", data["next_before"])
+	}
+}
+
+func TestLoginAuditSequence(t *testing.T) {
+	b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"audit_log_size": 64,
+	})
+
+	const logins = 32
+
+	results := startTestLogins(b, s, logins)
+	for i := 0; i < logins; i++ {
+		if err := <-results; err != nil {
+			t.Fatalf("login failed: %v", err)
+		}
+	}
+
+	records := readTestLoginAudit(t, b, s, nil)["logins"].([]map[string]interface{})
+	if len(records) != logins {
+		t.Fatalf("stored %d records for %d concurrent logins", len(records), logins)
+	}
+
+	for i, record := range records {
+		if want := uint64(logins - 1 - i); record["sequence"] != want {
+			t.Errorf("record %d has sequence %v, want %d", i, record["sequence"], want)
+		}
+	}
+
+	// A new backend on the same storage, such as after a restart, continues the sequence from the stored head.
+	restarted, _ := newTestBackend(t)
+
+	sequence, err := restarted.nextLoginAuditSequence(context.Background(), s)
+	if err != nil {
+		t.Fatalf("loading sequence: %v", err)
+	}
+
+	if sequence != logins {
+		t.Errorf("restarted sequence = %d, want %d", sequence, logins)
+	}
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+)
+
+const (
+	// loginErrorInvalidRequest is the error code of logins with missing or malformed fields.
+	loginErrorInvalidRequest = "invalid_request"
+
+	// loginErrorUnauthenticated is the error code of logins whose credential is invalid or expired.
+	// Clients should obtain a new credential before retrying.
+	loginErrorUnauthenticated = "unauthenticated"
+
+	// loginErrorPermissionDenied is the error code of logins denied by Keto or the credential's scope.
+	loginErrorPermissionDenied = "permission_denied"
+
+	// loginErrorUpstreamUnavailable is the error code of logins that failed because an Ory service is unavailable.
+	// Clients may retry later with the same credential.
+	loginErrorUpstreamUnavailable = "upstream_unavailable"
+
+	// loginErrorRateLimited is the error code of logins rejected by a login rate limit.
+	// Clients should back off before retrying.
+	loginErrorRateLimited = "rate_limited"
+
+	// loginErrorInternal is the error code of logins that failed for any other reason.
+	loginErrorInternal = "internal_error"
+)
+
+// loginError is a login failure with a machine-readable code and the HTTP status it is returned with.
+type loginError struct {
+	code   string
+	status int
+	err    error
+}
+
+// Error returns the message of the wrapped error.
+func (e *loginError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *loginError) Unwrap() error {
+	return e.err
+}
+
+// invalidRequestError returns a login error for a missing or malformed field.
+func invalidRequestError(err error) error {
+	return &loginError{code: loginErrorInvalidRequest, status: http.StatusBadRequest, err: err}
+}
+
+// unauthenticatedError returns a login error for an invalid or expired credential.
+func unauthenticatedError(err error) error {
+	return &loginError{code: loginErrorUnauthenticated, status: http.StatusUnauthorized, err: err}
+}
+
+// permissionDeniedError returns a login error for a denied login.
+func permissionDeniedError(err error) error {
+	return &loginError{code: loginErrorPermissionDenied, status: http.StatusForbidden, err: err}
+}
+
+// upstreamUnavailableError returns a login error for an unavailable Ory service.
+func upstreamUnavailableError(err error) error {
+	return &loginError{code: loginErrorUpstreamUnavailable, status: http.StatusServiceUnavailable, err: err}
+}
+
+// rateLimitedError returns a login error for a login rejected by a rate limit.
+func rateLimitedError(err error) error {
+	return &loginError{code: loginErrorRateLimited, status: http.StatusTooManyRequests, err: err}
+}
+
+// loginErrorCode returns the code of a login error, or loginErrorInternal if it has none.
+func loginErrorCode(err error) string {
+	var loginErr *loginError
+	if errors.As(err, &loginErr) {
+		return loginErr.code
+	}
+
+	return loginErrorInternal
+}
+
+// loginErrorResponse returns the response to a failed login, with the status of the login error
+// and a body carrying both the error message and its 'error_code'.
+// Errors which are not login errors are returned as internal errors.
+// Read-only storage errors are returned as they are, so Vault forwards the request to the active node.
+func loginErrorResponse(req *logical.Request, err error) (*logical.Response, error) {
+	if errors.Is(err, logical.ErrReadOnly) {
+		return nil, logical.ErrReadOnly
+	}
+
+	status := http.StatusInternalServerError
+
+	var loginErr *loginError
+	if errors.As(err, &loginErr) {
+		status = loginErr.status
+	}
+
+	body, marshalErr := json.Marshal(map[string]interface{}{
+		"request_id": req.ID,
+		"errors":     []string{err.Error()},
+		"error_code": loginErrorCode(err),
+	})
+	if marshalErr != nil {
+		return nil, marshalErr
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/json",
+			logical.HTTPStatusCode:  status,
+			logical.HTTPRawBody:     string(body),
+		},
+	}, nil
+}
@@ -0,0 +1,147 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+)
+
+// assertLoginErrorResponse asserts that the response is a raw login error response with the status and error code.
+func assertLoginErrorResponse(t *testing.T, res *logical.Response, status int, code string) {
+	t.Helper()
+
+	if res == nil {
+		t.Fatal("expected an error response, got none")
+	}
+
+	if got := res.Data[logical.HTTPStatusCode]; got != status {
+		t.Errorf("status = %v, want %d", got, status)
+	}
+
+	body := map[string]interface{}{}
+	err := json.Unmarshal([]byte(res.Data[logical.HTTPRawBody].(string)), &body)
+	if err != nil {
+		t.Fatalf("decoding response body: %v", err)
+	}
+
+	if got := body["error_code"]; got != code {
+		t.Errorf("error_code = %v, want %s", got, code)
+	}
+}
+
+func TestLoginErrorResponse(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{invalidRequestError(errors.New("bad")), http.StatusBadRequest, loginErrorInvalidRequest},
+		{unauthenticatedError(errors.New("bad")), http.StatusUnauthorized, loginErrorUnauthenticated},
+		{permissionDeniedError(errors.New("bad")), http.StatusForbidden, loginErrorPermissionDenied},
+		{rateLimitedError(errors.New("bad")), http.StatusTooManyRequests, loginErrorRateLimited},
+		{upstreamUnavailableError(errors.New("bad")), http.StatusServiceUnavailable, loginErrorUpstreamUnavailable},
+		{errors.Wrap(unauthenticatedError(errors.New("bad")), "wrapped"), http.StatusUnauthorized, loginErrorUnauthenticated},
+		{errors.New("bad"), http.StatusInternalServerError, loginErrorInternal},
+	}
+
+	for _, test := range tests {
+		t.Run(test.code, func(t *testing.T) {
+			res, err := loginErrorResponse(&logical.Request{ID: "request"}, test.err)
+			if err != nil {
+				t.Fatalf("building response: %v", err)
+			}
+
+			assertLoginErrorResponse(t, res, test.status, test.code)
+		})
+	}
+}
+
+func TestLoginErrorCodes(t *testing.T) {
+	b, s := newTestLoginBackend(t, &testKetoCheckServer{deny: true})
+
+	request := func(path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+
+		res, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation:  logical.UpdateOperation,
+			Path:       path,
+			Storage:    s,
+			Connection: &logical.Connection{RemoteAddr: "127.0.0.1"},
+			Data:       data,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+
+		return res
+	}
+
+	check := map[string]interface{}{"namespace": "files", "object": "reports", "relation": "view"}
+	with := func(fields map[string]interface{}) map[string]interface{} {
+		data := map[string]interface{}{}
+		for key, value := range check {
+			data[key] = value
+		}
+
+		for key, value := range fields {
+			data[key] = value
+		}
+
+		return data
+	}
+
+	t.Run("login invalid_request", func(t *testing.T) {
+		res := request("login", map[string]interface{}{"kratos_session_cookie": "cookie"})
+		assertLoginErrorResponse(t, res, http.StatusBadRequest, loginErrorInvalidRequest)
+	})
+
+	t.Run("login unauthenticated", func(t *testing.T) {
+		res := request("login", with(map[string]interface{}{"identity_grant": "unknown"}))
+		assertLoginErrorResponse(t, res, http.StatusUnauthorized, loginErrorUnauthenticated)
+	})
+
+	t.Run("login permission_denied", func(t *testing.T) {
+		res := request("login", with(map[string]interface{}{"kratos_session_cookie": "cookie"}))
+		assertLoginErrorResponse(t, res, http.StatusForbidden, loginErrorPermissionDenied)
+	})
+
+	t.Run("preview invalid_request", func(t *testing.T) {
+		res := request("login/preview", check)
+		assertLoginErrorResponse(t, res, http.StatusBadRequest, loginErrorInvalidRequest)
+	})
+
+	t.Run("preview unauthenticated", func(t *testing.T) {
+		res := request("login/preview", with(map[string]interface{}{"identity_id": "unknown"}))
+		assertLoginErrorResponse(t, res, http.StatusUnauthorized, loginErrorUnauthenticated)
+	})
+
+	t.Run("preview permission_denied", func(t *testing.T) {
+		res := request("login/preview", with(map[string]interface{}{"kratos_session_cookie": "cookie"}))
+		if res == nil || res.Data["allowed"] != false || res.Data["error_code"] != loginErrorPermissionDenied {
+			t.Errorf("expected a denied preview, got %v", res)
+		}
+	})
+
+	t.Run("login rate_limited", func(t *testing.T) {
+		writeTestConfig(t, b, s, map[string]interface{}{"rate_limit_ip": 1, "rate_limit_ip_burst": 1})
+
+		request("login", with(map[string]interface{}{"kratos_session_cookie": "cookie"}))
+		res := request("login", with(map[string]interface{}{"kratos_session_cookie": "cookie"}))
+		assertLoginErrorResponse(t, res, http.StatusTooManyRequests, loginErrorRateLimited)
+	})
+
+	t.Run("login upstream_unavailable", func(t *testing.T) {
+		writeTestConfig(t, b, s, map[string]interface{}{
+			"rate_limit_ip":        0,
+			"kratos_public_url":    "http://127.0.0.1:1",
+			"upstream_max_retries": 0,
+		})
+
+		res := request("login", with(map[string]interface{}{"kratos_session_cookie": "cookie"}))
+		assertLoginErrorResponse(t, res, http.StatusServiceUnavailable, loginErrorUpstreamUnavailable)
+	})
+}
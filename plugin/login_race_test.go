@@ -0,0 +1,161 @@
+package plugin
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"google.golang.org/grpc/connectivity"
+)
+
+// newTestLoginBackend returns a backend configured to log in against an in-process Kratos and Keto.
+func newTestLoginBackend(t *testing.T, checkServer *testKetoCheckServer) (*OryAuthBackend, logical.Storage) {
+	t.Helper()
+
+	b, s := newTestBackend(t)
+	startTestKeto(t, b, checkServer)
+
+	kratosURL := startTestKratos(t, "alice")
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"kratos_public_url": kratosURL,
+		"kratos_admin_url":  kratosURL,
+	})
+
+	return b, s
+}
+
+// startTestLogins starts logins for n different objects, and returns the channel their results are sent on.
+func startTestLogins(b *OryAuthBackend, s logical.Storage, n int) <-chan error {
+	results := make(chan error, n)
+
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			res, err := testLogin(b, s, fmt.Sprintf("report-%d", i))
+			switch {
+			case err != nil:
+				results <- err
+			case res == nil || res.Auth == nil:
+				results <- fmt.Errorf("login issued no auth: %v", res)
+			default:
+				results <- nil
+			}
+		}(i)
+	}
+
+	return results
+}
+
+func TestConcurrentFirstLogins(t *testing.T) {
+	b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+
+	const logins = 32
+
+	results := startTestLogins(b, s, logins)
+	for i := 0; i < logins; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("login failed: %v", err)
+		}
+	}
+}
+
+func TestKetoClientRotationWhileChecksInFlight(t *testing.T) {
+	rotations := map[string]func(t *testing.T, b *OryAuthBackend, s logical.Storage){
+		"config write": func(t *testing.T, b *OryAuthBackend, s logical.Storage) {
+			writeTestConfig(t, b, s, map[string]interface{}{
+				"upstream_timeout": 10,
+			})
+		},
+		"close": func(t *testing.T, b *OryAuthBackend, s logical.Storage) {
+			b.Close()
+		},
+	}
+
+	for name, rotate := range rotations {
+		t.Run(name, func(t *testing.T) {
+			const logins = 8
+
+			checkServer := &testKetoCheckServer{
+				started: make(chan struct{}, logins),
+				proceed: make(chan struct{}),
+			}
+
+			b, s := newTestLoginBackend(t, checkServer)
+
+			results := startTestLogins(b, s, logins)
+			for i := 0; i < logins; i++ {
+				<-checkServer.started
+			}
+
+			b.ketoClientMutex.RLock()
+			inUse := b.ketoClient
+			b.ketoClientMutex.RUnlock()
+
+			rotate(t, b, s)
+
+			// The drain must not close the connections while the checks are still in flight.
+			time.Sleep(50 * time.Millisecond)
+			if state := inUse.readConn.GetState(); state == connectivity.Shutdown {
+				t.Fatal("keto connection closed while checks were in flight")
+			}
+
+			close(checkServer.proceed)
+
+			for i := 0; i < logins; i++ {
+				if err := <-results; err != nil {
+					t.Errorf("login in flight during rotation failed: %v", err)
+				}
+			}
+
+			// Once the checks have finished, the drained client is closed.
+			deadline := time.Now().Add(2 * time.Second)
+			for inUse.readConn.GetState() != connectivity.Shutdown {
+				if time.Now().After(deadline) {
+					t.Fatal("keto connection not closed after the checks finished")
+				}
+
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			res, err := testLogin(b, s, "report-after-rotation")
+			if err != nil || res == nil || res.Auth == nil {
+				t.Fatalf("login after rotation failed: %v %v", res, err)
+			}
+
+			b.ketoClientMutex.RLock()
+			rotated := b.ketoClient != inUse
+			b.ketoClientMutex.RUnlock()
+
+			if !rotated {
+				t.Error("login after rotation used the closed keto client")
+			}
+		})
+	}
+}
+
+func TestKetoClientReleaseAndRotationRace(t *testing.T) {
+	b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 10; j++ {
+				b.Close()
+			}
+		}()
+	}
+
+	results := startTestLogins(b, s, 32)
+	for i := 0; i < 32; i++ {
+		if err := <-results; err != nil {
+			t.Errorf("login failed while clients were rotated: %v", err)
+		}
+	}
+
+	wg.Wait()
+}
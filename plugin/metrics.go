@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"strings"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// loginMethodKratosSession is the login method label of logins with a Kratos session cookie.
+	loginMethodKratosSession = "kratos_session"
+
+	// loginMethodIdentityGrant is the login method label of logins with an identity grant.
+	loginMethodIdentityGrant = "identity_grant"
+
+	// loginMethodOAuth2 is the login method label of logins with a Hydra OAuth2 access token.
+	loginMethodOAuth2 = "oauth2"
+
+	// loginMethodJWT is the login method label of logins with a JWT.
+	loginMethodJWT = "jwt"
+
+	// loginOutcomeSuccess is the outcome label of successful logins and upstream calls.
+	// Failures are labelled with their login error code.
+	loginOutcomeSuccess = "success"
+
+	// cacheNameSession is the cache label of the session cache.
+	cacheNameSession = "session"
+
+	// cacheNameCheck is the cache label of the check cache.
+	cacheNameCheck = "check"
+)
+
+var (
+	// metricLoginAttempts counts logins by mount, method, policy and outcome.
+	metricLoginAttempts = []string{"ory", "login", "attempts"}
+
+	// metricLoginLatency measures the duration of logins by mount, method and outcome.
+	metricLoginLatency = []string{"ory", "login", "latency"}
+
+	// metricUpstreamCalls counts the upstream calls made after coalescing.
+	metricUpstreamCalls = []string{"ory", "upstream", "calls"}
+
+	// metricUpstreamCoalesced counts the upstream calls coalesced into another one.
+	metricUpstreamCoalesced = []string{"ory", "upstream", "coalesced"}
+
+	// metricUpstreamLatency measures the duration of each attempt of a Kratos, Hydra or Keto call by upstream and outcome.
+	metricUpstreamLatency = []string{"ory", "upstream", "latency"}
+
+	// metricUpstreamRetries counts the retries of Kratos, Hydra and Keto calls by upstream.
+	metricUpstreamRetries = []string{"ory", "upstream", "retries"}
+
+	// metricCacheHits counts the lookups served from a cache, by cache.
+	metricCacheHits = []string{"ory", "cache", "hits"}
+
+	// metricCacheMisses counts the lookups not served from a cache, by cache.
+	metricCacheMisses = []string{"ory", "cache", "misses"}
+
+	// metricCircuitBreakerOpen is 1 while the circuit breaker of an upstream is open, and 0 otherwise.
+	metricCircuitBreakerOpen = []string{"ory", "circuit_breaker", "open"}
+
+	// metricCircuitBreakerRejected counts the calls failed fast by an open circuit breaker, by upstream.
+	metricCircuitBreakerRejected = []string{"ory", "circuit_breaker", "rejected"}
+
+	// metricTokenRevocations counts the tokens of denied identities and sessions revoked by the periodic sweep,
+	// by mount and outcome.
+	metricTokenRevocations = []string{"ory", "token", "revocations"}
+
+	// metricLoginAuditDropped counts the login decisions not stored in the login audit trail because of its write rate, by mount.
+	metricLoginAuditDropped = []string{"ory", "login", "audit_dropped"}
+
+	// metricTokenRenewals counts token renewals by mount and outcome, such as renewals refused by a deny list.
+	metricTokenRenewals = []string{"ory", "token", "renewals"}
+)
+
+// recordLogin counts a login attempt and measures its duration.
+// Successful logins are labelled with the policy they issue, namespace_relation. Failed logins are not,
+// as their namespace and relation are whatever the client sent, and would make the label unbounded.
+func recordLogin(
+	req *logical.Request,
+	method string,
+	namespace string,
+	relation string,
+	start time.Time,
+	err error,
+) {
+	outcome := loginOutcomeSuccess
+	if err != nil {
+		outcome = loginErrorCode(err)
+	}
+
+	labels := []metrics.Label{
+		{Name: "mount", Value: req.MountPoint},
+		{Name: "method", Value: method},
+		{Name: "outcome", Value: outcome},
+	}
+
+	metrics.MeasureSinceWithLabels(metricLoginLatency, start, labels)
+
+	if err == nil {
+		labels = append(labels, metrics.Label{Name: "policy", Value: strings.Join([]string{namespace, relation}, "_")})
+	}
+
+	metrics.IncrCounterWithLabels(metricLoginAttempts, 1, labels)
+}
+
+// recordTokenRenewal counts a token renewal, labelled with the login error code if it was refused.
+func recordTokenRenewal(req *logical.Request, err error) {
+	outcome := loginOutcomeSuccess
+	if err != nil {
+		outcome = loginErrorCode(err)
+	}
+
+	metrics.IncrCounterWithLabels(metricTokenRenewals, 1, []metrics.Label{
+		{Name: "mount", Value: req.MountPoint},
+		{Name: "outcome", Value: outcome},
+	})
+}
+
+// recordTokenRevocation counts a revocation of a token of a denied identity or session, labelled with the error code if it failed.
+func recordTokenRevocation(req *logical.Request, err error) {
+	outcome := loginOutcomeSuccess
+	if err != nil {
+		outcome = loginErrorCode(err)
+	}
+
+	metrics.IncrCounterWithLabels(metricTokenRevocations, 1, []metrics.Label{
+		{Name: "mount", Value: req.MountPoint},
+		{Name: "outcome", Value: outcome},
+	})
+}
+
+// recordLoginAuditDropped counts a login decision not stored in the login audit trail.
+func recordLoginAuditDropped(req *logical.Request) {
+	metrics.IncrCounterWithLabels(metricLoginAuditDropped, 1, []metrics.Label{
+		{Name: "mount", Value: req.MountPoint},
+	})
+}
+
+// recordCacheLookup counts a hit or miss of the named cache.
+func recordCacheLookup(cache string, hit bool) {
+	labels := []metrics.Label{{Name: "cache", Value: cache}}
+
+	if hit {
+		metrics.IncrCounterWithLabels(metricCacheHits, 1, labels)
+
+		return
+	}
+
+	metrics.IncrCounterWithLabels(metricCacheMisses, 1, labels)
+}
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+)
+
+// startTestMetrics sends metrics to an in-memory sink until the test ends, and returns the sink.
+func startTestMetrics(t *testing.T) *metrics.InmemSink {
+	t.Helper()
+
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+
+	config := metrics.DefaultConfig("vault")
+	config.EnableHostname = false
+	config.EnableRuntimeMetrics = false
+
+	_, err := metrics.NewGlobal(config, sink)
+	if err != nil {
+		t.Fatalf("creating metrics: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_, _ = metrics.NewGlobal(config, &metrics.BlackholeSink{})
+	})
+
+	return sink
+}
+
+// assertTestCounters asserts the counts of the counters in the sink.
+func assertTestCounters(t *testing.T, sink *metrics.InmemSink, want map[string]int) {
+	t.Helper()
+
+	counters := sink.Data()[0].Counters
+
+	for key, count := range want {
+		got := 0
+		if counter, ok := counters[key]; ok {
+			got = counter.Count
+		}
+
+		if got != count {
+			t.Errorf("%s = %d, want %d", key, got, count)
+		}
+	}
+}
+
+func TestRecordLoginPolicyLabel(t *testing.T) {
+	sink := startTestMetrics(t)
+
+	req := &logical.Request{MountPoint: "auth/ory/"}
+	recordLogin(req, loginMethodKratosSession, "files", "view", time.Now(), nil)
+	recordLogin(req, loginMethodKratosSession, "random-1", "random-2", time.Now(), permissionDeniedError(errors.New("denied")))
+
+	assertTestCounters(t, sink, map[string]int{
+		"vault.ory.login.attempts;mount=auth/ory/;method=kratos_session;outcome=success;policy=files_view":                  1,
+		"vault.ory.login.attempts;mount=auth/ory/;method=kratos_session;outcome=permission_denied":                          1,
+		"vault.ory.login.attempts;mount=auth/ory/;method=kratos_session;outcome=permission_denied;policy=random-1_random-2": 0,
+	})
+}
+
+func TestRecordTokenRenewal(t *testing.T) {
+	sink := startTestMetrics(t)
+
+	req := &logical.Request{MountPoint: "auth/ory/"}
+	recordTokenRenewal(req, nil)
+	recordTokenRenewal(req, permissionDeniedError(errors.New("identity is denied")))
+	recordTokenRenewal(req, permissionDeniedError(errors.New("session is denied")))
+
+	assertTestCounters(t, sink, map[string]int{
+		"vault.ory.token.renewals;mount=auth/ory/;outcome=success":           1,
+		"vault.ory.token.renewals;mount=auth/ory/;outcome=permission_denied": 2,
+	})
+}
+
+func TestRecordTokenRevocation(t *testing.T) {
+	sink := startTestMetrics(t)
+
+	req := &logical.Request{MountPoint: "auth/ory/"}
+	recordTokenRevocation(req, nil)
+	recordTokenRevocation(req, errors.New("connection refused"))
+
+	assertTestCounters(t, sink, map[string]int{
+		"vault.ory.token.revocations;mount=auth/ory/;outcome=success":        1,
+		"vault.ory.token.revocations;mount=auth/ory/;outcome=internal_error": 1,
+	})
+}
@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	// oryNetworkDomain is the domain under which Ory Network projects are served.
+	oryNetworkDomain = "projects.oryapis.com"
+)
+
+// parseOryProject returns the base URL of an Ory Network project given either its slug or its URL.
+func parseOryProject(project string) (string, error) {
+	project = strings.TrimSpace(project)
+	if project == "" {
+		return "", nil
+	}
+
+	if !strings.Contains(project, "://") {
+		if strings.ContainsAny(project, "./:") {
+			return "", errors.Errorf("invalid ory project slug %q", project)
+		}
+
+		return "https://" + project + "." + oryNetworkDomain, nil
+	}
+
+	parsed, err := url.Parse(project)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return "", errors.Errorf("invalid ory project URL %q", project)
+	}
+
+	return "https://" + parsed.Host, nil
+}
+
+// oryProjectKetoAddress returns the gRPC address of Keto for the Ory Network project at the given URL.
+func oryProjectKetoAddress(projectURL string) (string, error) {
+	parsed, err := url.Parse(projectURL)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid ory project URL")
+	}
+
+	if parsed.Port() != "" {
+		return parsed.Host, nil
+	}
+
+	return net.JoinHostPort(parsed.Hostname(), "443"), nil
+}
+
+// resetOryProjectConfig resets the Kratos URLs, Keto addresses and Hydra admin URL derived from
+// the Ory Network project URL to their defaults. Settings which no longer point at the project are kept.
+func resetOryProjectConfig(config *Config, projectURL string) error {
+	if projectURL == "" {
+		return nil
+	}
+
+	ketoAddress, err := oryProjectKetoAddress(projectURL)
+	if err != nil {
+		return err
+	}
+
+	defaults := defaultConfig()
+
+	if config.Kratos.publicURL() == projectURL {
+		config.Kratos.Servers = defaults.Kratos.Servers
+	}
+
+	if config.Kratos.adminURL() == projectURL {
+		config.Kratos.AdminServers = defaults.Kratos.AdminServers
+	}
+
+	if config.Keto.readAddress() == ketoAddress && config.Keto.writeAddress() == ketoAddress {
+		config.Keto.TransportConfig.Host = defaults.Keto.TransportConfig.Host
+		config.Keto.WriteAddress = defaults.Keto.WriteAddress
+		config.Keto.TLSEnabled = defaults.Keto.TLSEnabled
+	}
+
+	if config.Hydra.AdminURL == projectURL {
+		config.Hydra.AdminURL = defaults.Hydra.AdminURL
+	}
+
+	return nil
+}
+
+// bearerTokenCredentials sends a bearer token with every gRPC call.
+type bearerTokenCredentials struct {
+	token string
+}
+
+var _ credentials.PerRPCCredentials = (*bearerTokenCredentials)(nil)
+
+// GetRequestMetadata returns the authorization metadata for a gRPC call.
+func (c *bearerTokenCredentials) GetRequestMetadata(_ context.Context, _ ...string) (map[string]string, error) {
+	return map[string]string{
+		"authorization": "Bearer " + c.token,
+	}, nil
+}
+
+// RequireTransportSecurity reports that the token must only be sent over TLS.
+func (c *bearerTokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
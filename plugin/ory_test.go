@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"testing"
+)
+
+func TestUpdateOryConfigClearingProjectResetsDerivedSettings(t *testing.T) {
+	config := defaultConfig()
+
+	err := updateOryConfig(config, configFieldData(map[string]interface{}{
+		"ory_project": "affectionate-archimedes-abc123",
+	}))
+	if err != nil {
+		t.Fatalf("setting project: %v", err)
+	}
+
+	if config.Kratos.publicURL() != "https://affectionate-archimedes-abc123.projects.oryapis.com" {
+		t.Fatalf("kratos public URL not derived from project: %q", config.Kratos.publicURL())
+	}
+
+	err = updateOryConfig(config, configFieldData(map[string]interface{}{
+		"ory_project": "",
+	}))
+	if err != nil {
+		t.Fatalf("clearing project: %v", err)
+	}
+
+	defaults := defaultConfig()
+
+	if got, want := config.Kratos.publicURL(), defaults.Kratos.publicURL(); got != want {
+		t.Errorf("kratos public URL = %q, want %q", got, want)
+	}
+
+	if got, want := config.Kratos.adminURL(), defaults.Kratos.adminURL(); got != want {
+		t.Errorf("kratos admin URL = %q, want %q", got, want)
+	}
+
+	if got, want := config.Keto.readAddress(), defaults.Keto.readAddress(); got != want {
+		t.Errorf("keto read address = %q, want %q", got, want)
+	}
+
+	if got, want := config.Keto.writeAddress(), defaults.Keto.writeAddress(); got != want {
+		t.Errorf("keto write address = %q, want %q", got, want)
+	}
+
+	if config.Keto.TLSEnabled {
+		t.Error("keto TLS still enabled after clearing project")
+	}
+
+	if config.Hydra.AdminURL != defaults.Hydra.AdminURL {
+		t.Errorf("hydra admin URL = %q, want %q", config.Hydra.AdminURL, defaults.Hydra.AdminURL)
+	}
+}
+
+func TestUpdateOryConfigClearingProjectKeepsOverriddenSettings(t *testing.T) {
+	config := defaultConfig()
+
+	err := updateOryConfig(config, configFieldData(map[string]interface{}{
+		"ory_project": "affectionate-archimedes-abc123",
+	}))
+	if err != nil {
+		t.Fatalf("setting project: %v", err)
+	}
+
+	config.Hydra.AdminURL = "https://hydra.example.com"
+
+	err = updateOryConfig(config, configFieldData(map[string]interface{}{
+		"ory_project": "",
+	}))
+	if err != nil {
+		t.Fatalf("clearing project: %v", err)
+	}
+
+	if config.Hydra.AdminURL != "https://hydra.example.com" {
+		t.Errorf("overridden hydra admin URL was reset to %q", config.Hydra.AdminURL)
+	}
+}
@@ -0,0 +1,156 @@
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// pathAuditLoginsSynopsis is used to generate the help text for the login audit path.
+	pathAuditLoginsSynopsis = `
+Lists recent login decisions.
+`
+
+	// pathAuditLoginsDescription is used to generate the help text for the login audit path.
+	pathAuditLoginsDescription = `
+Returns the most recent login decisions stored in the login audit trail, newest
+first: the time, method, identity ID, policy, Keto check, outcome, reason and
+client address of each login. Decisions can be filtered by identity ID and
+outcome. The trail is a ring buffer of 'audit_log_size' decisions, and
+decisions older than 'audit_log_retention' are deleted periodically.
+
+Each request reads at most 1000 decisions. If more remain, 'next_before' is
+returned, and passing it as 'before' continues with the older decisions.
+`
+
+	// defaultLoginAuditLimit is the number of login decisions returned when no limit is requested.
+	defaultLoginAuditLimit = 100
+
+	// loginAuditScanLimit is the number of login decisions read per request, whether or not they match the filters.
+	loginAuditScanLimit = 1000
+)
+
+// NewPathAuditLogins returns the path for reading the login audit trail.
+func NewPathAuditLogins(b *OryAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "audit/logins$",
+			Fields: map[string]*framework.FieldSchema{
+				"identity_id": {
+					Type:        framework.TypeString,
+					Description: "If set, only decisions for this identity ID or Keto subject are returned.",
+				},
+				"outcome": {
+					Type:        framework.TypeString,
+					Description: "If set, only decisions with this outcome are returned, such as success or permission_denied.",
+				},
+				"limit": {
+					Type:        framework.TypeInt,
+					Default:     defaultLoginAuditLimit,
+					Description: "Maximum number of decisions returned. Defaults to 100.",
+				},
+				"before": {
+					Type:        framework.TypeInt,
+					Description: "If set, only decisions with a lower sequence number are returned, such as the 'next_before' of a previous request.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation: b.readAuditLoginsHandler,
+			},
+			HelpSynopsis:    pathAuditLoginsSynopsis,
+			HelpDescription: pathAuditLoginsDescription,
+		},
+	}
+}
+
+// readAuditLoginsHandler returns the login decisions matching the filters, newest first.
+// Decisions are read from the head of the ring buffer back, so only the decisions needed are loaded.
+func (b *OryAuthBackend) readAuditLoginsHandler(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	identityID := data.Get("identity_id").(string)
+	outcome := data.Get("outcome").(string)
+
+	limit := data.Get("limit").(int)
+	if limit <= 0 {
+		return logical.ErrorResponse("limit must be positive"), nil
+	}
+
+	before := data.Get("before").(int)
+	if before < 0 {
+		return logical.ErrorResponse("before must not be negative"), nil
+	}
+
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	logins := make([]map[string]interface{}, 0, limit)
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			"logins": logins,
+		},
+	}
+
+	if config == nil || config.Audit == nil || config.Audit.Size <= 0 {
+		return res, nil
+	}
+
+	next, err := readLoginAuditHead(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var oldest uint64
+	if size := uint64(config.Audit.Size); next > size {
+		oldest = next - size
+	}
+
+	sequence := next
+	if before > 0 && uint64(before) < sequence {
+		sequence = uint64(before)
+	}
+
+	for scanned := 0; sequence > oldest && len(logins) < limit && scanned < loginAuditScanLimit; scanned++ {
+		sequence--
+
+		record, err := readLoginAuditRecord(ctx, req.Storage, config.Audit.Size, sequence)
+		if err != nil {
+			return nil, err
+		}
+
+		if record == nil {
+			continue
+		}
+
+		if (identityID != "" && record.IdentityID != identityID) || (outcome != "" && record.Outcome != outcome) {
+			continue
+		}
+
+		logins = append(logins, map[string]interface{}{
+			"sequence":    record.Sequence,
+			"time":        record.Time.Format(time.RFC3339Nano),
+			"method":      record.Method,
+			"identity_id": record.IdentityID,
+			"policy":      record.Policy,
+			"check":       record.Check,
+			"outcome":     record.Outcome,
+			"reason":      record.Reason,
+			"remote_addr": record.RemoteAddr,
+		})
+	}
+
+	res.Data["logins"] = logins
+
+	if sequence > oldest {
+		res.Data["next_before"] = sequence
+	}
+
+	return res, nil
+}
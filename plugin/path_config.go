@@ -2,9 +2,15 @@ package plugin
 
 import (
 	"context"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/parseutil"
 	"github.com/hashicorp/vault/sdk/logical"
+	keto "github.com/ory/keto-client-go/client"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -13,14 +19,328 @@ const (
 
 	// configDescription is used to provide a detailed description of the config path.
 	configDescription = `This endpoint configures the details for accessing Ory APIs.`
+
+	// verifyConnectionTimeout is the maximum time spent verifying the Ory services on config write.
+	verifyConnectionTimeout = 10 * time.Second
 )
 
 var configFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
-	// TODO (TW) Add fields for configuring the Ory services.
-	// "kratos_auth_url": {
-	// 	Type:        framework.TypeString,
-	// 	Description: "Kratos authentication URL",
-	// },
+	"kratos_public_url": {
+		Type:        framework.TypeString,
+		Default:     defaultKratosPublicURL,
+		Description: "URL of the Ory Kratos public API, used to validate sessions.",
+	},
+	"kratos_admin_url": {
+		Type:        framework.TypeString,
+		Default:     defaultKratosAdminURL,
+		Description: "URL of the Ory Kratos admin API, used for privileged calls such as identity lookups.",
+	},
+	"kratos_user_agent": {
+		Type:        framework.TypeString,
+		Description: "User agent sent with requests to the Ory Kratos API.",
+	},
+	"kratos_default_headers": {
+		Type:        framework.TypeKVPairs,
+		Description: "Headers sent with every request to the Ory Kratos API. Not returned on read.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"kratos_debug": {
+		Type:        framework.TypeBool,
+		Description: "If true, the headers of Ory Kratos API requests and responses are logged at debug level, with cookies and tokens redacted.",
+	},
+	"kratos_tls_ca_cert": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded CA certificate used to verify the Ory Kratos API server certificate.",
+	},
+	"kratos_tls_client_cert": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded client certificate presented to the Ory Kratos API.",
+	},
+	"kratos_tls_client_key": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded private key for the Ory Kratos client certificate. Not returned on read.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"kratos_tls_server_name": {
+		Type:        framework.TypeString,
+		Description: "Server name used to verify the Ory Kratos API server certificate.",
+	},
+	"kratos_tls_skip_verify": {
+		Type:        framework.TypeBool,
+		Description: "If true, the Ory Kratos API server certificate is not verified.",
+	},
+	"keto_read_address": {
+		Type:        framework.TypeString,
+		Default:     defaultKetoReadAddress,
+		Description: "Address (host:port) of the Ory Keto read gRPC API, used for checks, expansion and listing.",
+	},
+	"keto_write_address": {
+		Type:        framework.TypeString,
+		Default:     defaultKetoWriteAddress,
+		Description: "Address (host:port) of the Ory Keto write gRPC API, used to manage relation tuples.",
+	},
+	"keto_tls": {
+		Type:        framework.TypeBool,
+		Description: "If true, TLS is used to connect to the Ory Keto gRPC API.",
+	},
+	"keto_tls_ca_cert": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded CA certificate used to verify the Ory Keto API server certificate.",
+	},
+	"keto_tls_client_cert": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded client certificate presented to the Ory Keto API.",
+	},
+	"keto_tls_client_key": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded private key for the Ory Keto client certificate. Not returned on read.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"keto_tls_server_name": {
+		Type:        framework.TypeString,
+		Description: "Server name used to verify the Ory Keto API server certificate.",
+	},
+	"keto_tls_skip_verify": {
+		Type:        framework.TypeBool,
+		Description: "If true, the Ory Keto API server certificate is not verified.",
+	},
+	"hydra_admin_url": {
+		Type:        framework.TypeString,
+		Description: "URL of the Ory Hydra admin API, used to introspect OAuth2 access tokens. OAuth2 login is disabled if empty.",
+	},
+	"hydra_introspection_path": {
+		Type:        framework.TypeString,
+		Default:     defaultHydraIntrospectionPath,
+		Description: "Path of the token introspection endpoint on the Ory Hydra admin API.",
+	},
+	"hydra_required_scopes": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Scopes an OAuth2 access token must have been granted to log in on this mount.",
+	},
+	"hydra_required_audiences": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Audiences an OAuth2 access token must have been issued for to log in on this mount.",
+	},
+	"hydra_subject_claim": {
+		Type:    framework.TypeString,
+		Default: hydraSubjectClaimSubject,
+		Description: `Claim of the introspected OAuth2 access token used as the Keto subject, either 'sub' or 'client_id'.
+Defaults to 'sub'.`,
+	},
+	"hydra_tls_ca_cert": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded CA certificate used to verify the Ory Hydra API server certificate.",
+	},
+	"hydra_tls_client_cert": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded client certificate presented to the Ory Hydra API.",
+	},
+	"hydra_tls_client_key": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded private key for the Ory Hydra client certificate. Not returned on read.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"hydra_tls_server_name": {
+		Type:        framework.TypeString,
+		Description: "Server name used to verify the Ory Hydra API server certificate.",
+	},
+	"hydra_tls_skip_verify": {
+		Type:        framework.TypeBool,
+		Description: "If true, the Ory Hydra API server certificate is not verified.",
+	},
+	"jwt_jwks_url": {
+		Type:        framework.TypeString,
+		Description: "URL of the JWKS used to verify login JWTs. Mutually exclusive with jwt_public_keys.",
+	},
+	"jwt_jwks_ca_cert": {
+		Type:        framework.TypeString,
+		Description: "PEM encoded CA certificate used to verify the JWKS server certificate.",
+	},
+	"jwt_public_keys": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "PEM encoded public keys or certificates used to verify login JWTs. Mutually exclusive with jwt_jwks_url.",
+	},
+	"jwt_bound_issuer": {
+		Type:        framework.TypeString,
+		Description: "If set, the 'iss' claim of login JWTs must match it.",
+	},
+	"jwt_bound_audiences": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "If set, the 'aud' claim of login JWTs must contain at least one of them.",
+	},
+	"jwt_leeway": {
+		Type:        framework.TypeDurationSecond,
+		Default:     int(defaultJWTLeeway.Seconds()),
+		Description: "Clock skew allowed when validating the time claims of login JWTs. Defaults to 60 seconds.",
+	},
+	"jwt_subject_claim": {
+		Type:    framework.TypeString,
+		Default: defaultJWTSubjectClaim,
+		Description: `Claim of login JWTs used as the Keto subject. Nested claims are given as a dot separated path,
+such as session.identity.id. Defaults to 'sub'.`,
+	},
+	"session_cache_size": {
+		Type:        framework.TypeInt,
+		Default:     defaultSessionCacheSize,
+		Description: "Maximum number of validated Kratos sessions cached in memory. Defaults to 1024.",
+	},
+	"session_cache_ttl": {
+		Type: framework.TypeDurationSecond,
+		Description: `Maximum time a validated Kratos session is cached for, and not validated again at login.
+Sessions are never cached past their expiry. Defaults to 0, which disables the cache.`,
+	},
+	"check_cache_size": {
+		Type:        framework.TypeInt,
+		Default:     defaultCheckCacheSize,
+		Description: "Maximum number of Keto check results cached in memory. Defaults to 4096.",
+	},
+	"check_cache_positive_ttl": {
+		Type: framework.TypeDurationSecond,
+		Description: `Time an allowed Keto check result is cached for, at most 5 minutes.
+The cache is held in memory on each node, and writing or deleting tuples only purges it on the node handling the request,
+so other nodes may keep allowing a removed relation for this long. Defaults to 0, which disables caching allowed results.`,
+	},
+	"check_cache_negative_ttl": {
+		Type:        framework.TypeDurationSecond,
+		Description: "Time a denied Keto check result is cached for. Defaults to 0, which disables caching denied results.",
+	},
+	"check_cache_exempt_namespaces": {
+		Type:        framework.TypeCommaStringSlice,
+		Description: "Keto namespaces whose checks are never cached, such as security-sensitive ones. Applies to every login on this mount.",
+	},
+	"upstream_timeout": {
+		Type:        framework.TypeDurationSecond,
+		Default:     int(defaultUpstreamTimeout.Seconds()),
+		Description: "Timeout of a single call to Kratos, Hydra or Keto during login. Defaults to 5 seconds.",
+	},
+	"upstream_max_retries": {
+		Type:    framework.TypeInt,
+		Default: defaultUpstreamMaxRetries,
+		Description: `Number of times a call to Kratos, Hydra or Keto is retried after a retryable failure,
+such as a timeout, a 5xx response or a gRPC Unavailable error. Defaults to 2.`,
+	},
+	"circuit_breaker_threshold": {
+		Type:    framework.TypeInt,
+		Default: defaultCircuitBreakerThreshold,
+		Description: `Number of consecutive failed calls after which calls to Kratos, Hydra or Keto fail fast.
+Defaults to 5. 0 disables the circuit breaker.`,
+	},
+	"circuit_breaker_cooldown": {
+		Type:        framework.TypeDurationSecond,
+		Default:     int(defaultCircuitBreakerCooldown.Seconds()),
+		Description: "Time calls fail fast for once the circuit breaker opens, before a trial call is made. Defaults to 30 seconds.",
+	},
+	"bound_cidrs": {
+		Type: framework.TypeCommaStringSlice,
+		Description: `CIDR blocks logins are accepted from, checked against the client address.
+Applies to every login on this mount. Logins are accepted from any address if empty.`,
+	},
+	"token_bound_cidrs": {
+		Type: framework.TypeCommaStringSlice,
+		Description: `CIDR blocks issued tokens can be used from. Defaults to 'bound_cidrs'.
+Applies to every token issued by this mount. Tokens can be used from any address if both are empty.`,
+	},
+	"token_ttl": {
+		Type:    framework.TypeDurationSecond,
+		Default: int(defaultTokenTTL.Seconds()),
+		Description: `Time issued tokens are valid for before they must be renewed, capped by the credential's expiry.
+Renewals of tokens of denied identities and sessions are refused. Defaults to 15 minutes.`,
+	},
+	"token_max_ttl": {
+		Type:        framework.TypeDurationSecond,
+		Default:     int(defaultTokenMaxTTL.Seconds()),
+		Description: "Time issued tokens can be renewed for, capped by the credential's expiry. Defaults to 1 hour. 0 uses the system maximum.",
+	},
+	"token_period": {
+		Type: framework.TypeDurationSecond,
+		Description: `If set, issued tokens are periodic, and each renewal extends them by this period until the credential expires.
+Defaults to 0, which issues tokens with token_ttl and token_max_ttl.`,
+	},
+	"revocation_vault_addr": {
+		Type: framework.TypeString,
+		Description: `Address of the Vault API used to revoke the tokens of denied identities and sessions, such as https://127.0.0.1:8200.
+Tokens are tracked from their first renewal, and revoked periodically once denied. Disabled while empty.`,
+	},
+	"revocation_vault_token": {
+		Type:        framework.TypeString,
+		Description: "Vault token allowed to update auth/token/revoke-accessor, used to revoke tokens. Not returned on read.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"audit_log_size": {
+		Type: framework.TypeInt,
+		Description: `Number of recent login decisions stored in the login audit trail at audit/logins.
+The oldest decisions are overwritten once it is full. Defaults to 0, which disables the trail.`,
+	},
+	"audit_log_retention": {
+		Type: framework.TypeDurationSecond,
+		Description: `Time login decisions are kept in the login audit trail before they are deleted.
+Defaults to 0, which keeps them until they are overwritten.`,
+	},
+	"rate_limit_ip": {
+		Type: framework.TypeInt,
+		Description: `Logins per minute allowed from a client IP address. Further logins are rejected with 429.
+Defaults to 0, which disables the limit.`,
+	},
+	"rate_limit_ip_burst": {
+		Type:        framework.TypeInt,
+		Description: "Logins allowed at once from a client IP address. Defaults to 0, which allows rate_limit_ip at once.",
+	},
+	"rate_limit_session": {
+		Type: framework.TypeInt,
+		Description: `Logins per minute allowed with the same session cookie, OAuth2 access token or JWT.
+Further logins are rejected with 429. Defaults to 0, which disables the limit.`,
+	},
+	"rate_limit_session_burst": {
+		Type:        framework.TypeInt,
+		Description: "Logins allowed at once with the same credential. Defaults to 0, which allows rate_limit_session at once.",
+	},
+	"rate_limit_identity": {
+		Type: framework.TypeInt,
+		Description: `Logins per minute allowed for the same identity or OAuth2 client. Further logins are rejected with 429.
+Defaults to 0, which disables the limit.`,
+	},
+	"rate_limit_identity_burst": {
+		Type:        framework.TypeInt,
+		Description: "Logins allowed at once for the same identity. Defaults to 0, which allows rate_limit_identity at once.",
+	},
+	"tracing_otlp_endpoint": {
+		Type: framework.TypeString,
+		Description: `URL of the OTLP/HTTP traces endpoint logins are traced to, such as http://otel-collector:4318/v1/traces.
+Trace context is propagated to Kratos and Keto. Tracing is disabled while empty.`,
+	},
+	"tracing_sample_ratio": {
+		Type:        framework.TypeFloat,
+		Default:     defaultTracingSampleRatio,
+		Description: "Ratio of logins traced, between 0 and 1. Defaults to 1, tracing every login.",
+	},
+	"ory_project": {
+		Type: framework.TypeString,
+		Description: `Slug or URL of an Ory Network project.
+If set, kratos_public_url, kratos_admin_url, keto_read_address, keto_write_address and hydra_admin_url are derived from the project unless also given.`,
+	},
+	"ory_api_key": {
+		Type:        framework.TypeString,
+		Description: "Ory Network project API key (ory_pat_...) sent as a bearer token on admin calls. Not returned on read.",
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"verify_connection": {
+		Type:    framework.TypeBool,
+		Default: true,
+		Description: `If true, the Kratos, Keto and, if configured, Hydra and JWKS connections are verified before the configuration is saved.
+Defaults to true.`,
+	},
 }
 
 // NewPathConfig creates a new path for configuring the backend.
@@ -33,20 +353,36 @@ func NewPathConfig(b *OryAuthBackend) []*framework.Path {
 				logical.CreateOperation: b.updateConfigHandler,
 				logical.ReadOperation:   b.readConfigHandler,
 				logical.UpdateOperation: b.updateConfigHandler,
+				logical.DeleteOperation: b.deleteConfigHandler,
 			},
+			ExistenceCheck:  b.configExistenceCheck,
 			HelpSynopsis:    configSynopsis,
 			HelpDescription: configDescription,
 		},
 	}
 }
 
+// configExistenceCheck checks whether the configuration exists in the storage.
+func (b *OryAuthBackend) configExistenceCheck(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (bool, error) {
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		return false, err
+	}
+
+	return config != nil, nil
+}
+
 // readConfigHandler reads the configuration from the storage.
+// Sensitive fields (private keys, API keys and headers which may carry them) are not returned.
 func (b *OryAuthBackend) readConfigHandler(
 	ctx context.Context,
 	req *logical.Request,
 	data *framework.FieldData,
 ) (*logical.Response, error) {
-	// TODO (TW) https://developer.hashicorp.com/vault/docs/concepts/integrated-storage
 	config, err := b.readConfig(ctx, req.Storage)
 	if err != nil {
 		return nil, err
@@ -56,9 +392,86 @@ func (b *OryAuthBackend) readConfigHandler(
 		return nil, nil
 	}
 
+	kratosTLS := config.Kratos.TLS
+	if kratosTLS == nil {
+		kratosTLS = &TLSConfig{}
+	}
+
+	ketoTLS := config.Keto.TLS
+	if ketoTLS == nil {
+		ketoTLS = &TLSConfig{}
+	}
+
+	hydraTLS := config.Hydra.TLS
+	if hydraTLS == nil {
+		hydraTLS = &TLSConfig{}
+	}
+
+	jwtTLS := config.JWT.TLS
+	if jwtTLS == nil {
+		jwtTLS = &TLSConfig{}
+	}
+
 	res := &logical.Response{
 		Data: map[string]interface{}{
-			"kratos_auth_url": config.KratosAuthURL,
+			"kratos_public_url":             config.Kratos.publicURL(),
+			"kratos_admin_url":              config.Kratos.adminURL(),
+			"kratos_user_agent":             config.Kratos.UserAgent,
+			"kratos_debug":                  config.Kratos.Debug,
+			"kratos_tls_ca_cert":            kratosTLS.CACert,
+			"kratos_tls_client_cert":        kratosTLS.ClientCert,
+			"kratos_tls_server_name":        kratosTLS.ServerName,
+			"kratos_tls_skip_verify":        kratosTLS.SkipVerify,
+			"keto_read_address":             config.Keto.readAddress(),
+			"keto_write_address":            config.Keto.writeAddress(),
+			"keto_tls":                      config.Keto.TLSEnabled,
+			"keto_tls_ca_cert":              ketoTLS.CACert,
+			"keto_tls_client_cert":          ketoTLS.ClientCert,
+			"keto_tls_server_name":          ketoTLS.ServerName,
+			"keto_tls_skip_verify":          ketoTLS.SkipVerify,
+			"hydra_admin_url":               config.Hydra.AdminURL,
+			"hydra_introspection_path":      config.Hydra.IntrospectionPath,
+			"hydra_required_scopes":         config.Hydra.RequiredScopes,
+			"hydra_required_audiences":      config.Hydra.RequiredAudiences,
+			"hydra_subject_claim":           config.Hydra.SubjectClaim,
+			"hydra_tls_ca_cert":             hydraTLS.CACert,
+			"hydra_tls_client_cert":         hydraTLS.ClientCert,
+			"hydra_tls_server_name":         hydraTLS.ServerName,
+			"hydra_tls_skip_verify":         hydraTLS.SkipVerify,
+			"jwt_jwks_url":                  config.JWT.JWKSURL,
+			"jwt_jwks_ca_cert":              jwtTLS.CACert,
+			"jwt_public_keys":               config.JWT.PublicKeys,
+			"jwt_bound_issuer":              config.JWT.BoundIssuer,
+			"jwt_bound_audiences":           config.JWT.BoundAudiences,
+			"jwt_leeway":                    int64(config.JWT.Leeway.Seconds()),
+			"jwt_subject_claim":             config.JWT.SubjectClaim,
+			"session_cache_size":            config.SessionCache.Size,
+			"session_cache_ttl":             int64(config.SessionCache.TTL.Seconds()),
+			"check_cache_size":              config.CheckCache.Size,
+			"check_cache_positive_ttl":      int64(config.CheckCache.PositiveTTL.Seconds()),
+			"check_cache_negative_ttl":      int64(config.CheckCache.NegativeTTL.Seconds()),
+			"check_cache_exempt_namespaces": config.CheckCache.ExemptNamespaces,
+			"upstream_timeout":              int64(config.Resilience.Timeout.Seconds()),
+			"upstream_max_retries":          config.Resilience.MaxRetries,
+			"circuit_breaker_threshold":     config.Resilience.BreakerThreshold,
+			"circuit_breaker_cooldown":      int64(config.Resilience.BreakerCooldown.Seconds()),
+			"tracing_otlp_endpoint":         config.Tracing.Endpoint,
+			"tracing_sample_ratio":          config.Tracing.SampleRatio,
+			"bound_cidrs":                   config.CIDR.BoundCIDRs,
+			"token_bound_cidrs":             config.CIDR.TokenBoundCIDRs,
+			"token_ttl":                     int64(config.Token.TTL.Seconds()),
+			"token_max_ttl":                 int64(config.Token.MaxTTL.Seconds()),
+			"token_period":                  int64(config.Token.Period.Seconds()),
+			"revocation_vault_addr":         config.Token.RevocationAddress,
+			"audit_log_size":                config.Audit.Size,
+			"audit_log_retention":           int64(config.Audit.Retention.Seconds()),
+			"rate_limit_ip":                 config.RateLimit.IP,
+			"rate_limit_ip_burst":           config.RateLimit.IPBurst,
+			"rate_limit_session":            config.RateLimit.Session,
+			"rate_limit_session_burst":      config.RateLimit.SessionBurst,
+			"rate_limit_identity":           config.RateLimit.Identity,
+			"rate_limit_identity_burst":     config.RateLimit.IdentityBurst,
+			"ory_project":                   config.Ory.ProjectURL,
 		},
 	}
 
@@ -71,23 +484,56 @@ func (b *OryAuthBackend) updateConfigHandler(
 	req *logical.Request,
 	data *framework.FieldData,
 ) (*logical.Response, error) {
-	var (
-		val interface{}
-		ok  bool
-	)
-
 	config, err := b.readConfig(ctx, req.Storage)
 	if err != nil {
 		return nil, err
 	}
 
 	if config == nil {
-		config = &Config{}
+		config = defaultConfig()
+	}
+
+	err = updateOryConfig(config, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	err = updateKratosConfig(config.Kratos, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	updateKetoConfig(config.Keto, data)
+
+	err = updateHydraConfig(config.Hydra, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	err = updateJWTConfig(config.JWT, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	updateSessionCacheConfig(config.SessionCache, data)
+	updateCheckCacheConfig(config.CheckCache, data)
+	updateResilienceConfig(config.Resilience, data)
+	updateTracingConfig(config.Tracing, data)
+	updateRateLimitConfig(config.RateLimit, data)
+	updateCIDRConfig(config.CIDR, data)
+	updateAuditConfig(config.Audit, data)
+	updateTokenConfig(config.Token, data)
+
+	err = validateConfig(config)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	val, ok = data.GetOk("kratos_url")
-	if ok {
-		config.KratosAuthURL = val.(string)
+	if data.Get("verify_connection").(bool) {
+		err = b.verifyConnection(ctx, config)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
 	}
 
 	entry, err := logical.StorageEntryJSON("config", config)
@@ -104,3 +550,639 @@ func (b *OryAuthBackend) updateConfigHandler(
 
 	return nil, nil
 }
+
+// deleteConfigHandler deletes the configuration from the storage.
+func (b *OryAuthBackend) deleteConfigHandler(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	err := req.Storage.Delete(ctx, "config")
+	if err != nil {
+		return nil, err
+	}
+
+	b.Close()
+
+	return nil, nil
+}
+
+// updateOryConfig updates the Ory Network configuration with the fields set in the request.
+// Setting a project points Kratos and Keto at it, and clearing it points them back at the defaults,
+// so it must be applied before the Kratos and Keto fields.
+func updateOryConfig(config *Config, data *framework.FieldData) error {
+	if val, ok := data.GetOk("ory_api_key"); ok {
+		apiKey := val.(string)
+		if apiKey != "" && !strings.HasPrefix(apiKey, "ory_pat_") {
+			return errors.New("ory_api_key must be an Ory project API key (ory_pat_...)")
+		}
+
+		config.Ory.APIKey = apiKey
+	}
+
+	val, ok := data.GetOk("ory_project")
+	if !ok {
+		return nil
+	}
+
+	projectURL, err := parseOryProject(val.(string))
+	if err != nil {
+		return err
+	}
+
+	previousProjectURL := config.Ory.ProjectURL
+
+	config.Ory.ProjectURL = projectURL
+	if projectURL == "" {
+		return resetOryProjectConfig(config, previousProjectURL)
+	}
+
+	ketoAddress, err := oryProjectKetoAddress(projectURL)
+	if err != nil {
+		return err
+	}
+
+	config.Kratos.Servers = ServerConfigurations{
+		ServerConfiguration{
+			URL:         projectURL,
+			Description: "Ory Network Public API",
+		},
+	}
+	config.Kratos.AdminServers = ServerConfigurations{
+		ServerConfiguration{
+			URL:         projectURL,
+			Description: "Ory Network Admin API",
+		},
+	}
+
+	if config.Keto.TransportConfig == nil {
+		config.Keto.TransportConfig = &keto.TransportConfig{}
+	}
+
+	config.Keto.TransportConfig.Host = ketoAddress
+	config.Keto.WriteAddress = ketoAddress
+	config.Keto.TLSEnabled = true
+
+	config.Hydra.AdminURL = projectURL
+
+	return nil
+}
+
+// updateKratosConfig updates the Kratos configuration with the fields set in the request.
+func updateKratosConfig(config *KratosConfig, data *framework.FieldData) error {
+	if config.TLS == nil {
+		config.TLS = &TLSConfig{}
+	}
+
+	if val, ok := data.GetOk("kratos_public_url"); ok {
+		publicURL, err := parseKratosURL("kratos_public_url", val.(string))
+		if err != nil {
+			return err
+		}
+
+		config.Servers = ServerConfigurations{
+			ServerConfiguration{
+				URL:         publicURL,
+				Description: "Ory Kratos Public API",
+			},
+		}
+	}
+
+	if val, ok := data.GetOk("kratos_admin_url"); ok {
+		adminURL, err := parseKratosURL("kratos_admin_url", val.(string))
+		if err != nil {
+			return err
+		}
+
+		config.AdminServers = ServerConfigurations{
+			ServerConfiguration{
+				URL:         adminURL,
+				Description: "Ory Kratos Admin API",
+			},
+		}
+	}
+
+	if val, ok := data.GetOk("kratos_user_agent"); ok {
+		config.UserAgent = val.(string)
+	}
+
+	if val, ok := data.GetOk("kratos_default_headers"); ok {
+		config.DefaultHeader = val.(map[string]string)
+	}
+
+	if val, ok := data.GetOk("kratos_debug"); ok {
+		config.Debug = val.(bool)
+	}
+
+	if val, ok := data.GetOk("kratos_tls_ca_cert"); ok {
+		config.TLS.CACert = val.(string)
+	}
+
+	if val, ok := data.GetOk("kratos_tls_client_cert"); ok {
+		config.TLS.ClientCert = val.(string)
+	}
+
+	if val, ok := data.GetOk("kratos_tls_client_key"); ok {
+		config.TLS.ClientKey = val.(string)
+	}
+
+	if val, ok := data.GetOk("kratos_tls_server_name"); ok {
+		config.TLS.ServerName = val.(string)
+	}
+
+	if val, ok := data.GetOk("kratos_tls_skip_verify"); ok {
+		config.TLS.SkipVerify = val.(bool)
+	}
+
+	return nil
+}
+
+// parseKratosURL validates a Kratos API URL and strips any trailing slash.
+func parseKratosURL(field string, kratosURL string) (string, error) {
+	parsed, err := url.Parse(kratosURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", errors.Errorf("invalid %s %q", field, kratosURL)
+	}
+
+	return strings.TrimSuffix(kratosURL, "/"), nil
+}
+
+// updateKetoConfig updates the Keto configuration with the fields set in the request.
+func updateKetoConfig(config *KetoConfig, data *framework.FieldData) {
+	if config.TransportConfig == nil {
+		config.TransportConfig = &keto.TransportConfig{}
+	}
+
+	if config.TLS == nil {
+		config.TLS = &TLSConfig{}
+	}
+
+	if val, ok := data.GetOk("keto_read_address"); ok {
+		config.TransportConfig.Host = val.(string)
+	}
+
+	if val, ok := data.GetOk("keto_write_address"); ok {
+		config.WriteAddress = val.(string)
+	}
+
+	if val, ok := data.GetOk("keto_tls"); ok {
+		config.TLSEnabled = val.(bool)
+	}
+
+	if val, ok := data.GetOk("keto_tls_ca_cert"); ok {
+		config.TLS.CACert = val.(string)
+	}
+
+	if val, ok := data.GetOk("keto_tls_client_cert"); ok {
+		config.TLS.ClientCert = val.(string)
+	}
+
+	if val, ok := data.GetOk("keto_tls_client_key"); ok {
+		config.TLS.ClientKey = val.(string)
+	}
+
+	if val, ok := data.GetOk("keto_tls_server_name"); ok {
+		config.TLS.ServerName = val.(string)
+	}
+
+	if val, ok := data.GetOk("keto_tls_skip_verify"); ok {
+		config.TLS.SkipVerify = val.(bool)
+	}
+}
+
+// updateHydraConfig updates the Hydra configuration with the fields set in the request.
+func updateHydraConfig(config *HydraConfig, data *framework.FieldData) error {
+	if config.TLS == nil {
+		config.TLS = &TLSConfig{}
+	}
+
+	if val, ok := data.GetOk("hydra_admin_url"); ok {
+		config.AdminURL = ""
+
+		if val.(string) != "" {
+			adminURL, err := parseKratosURL("hydra_admin_url", val.(string))
+			if err != nil {
+				return err
+			}
+
+			config.AdminURL = adminURL
+		}
+	}
+
+	if val, ok := data.GetOk("hydra_introspection_path"); ok {
+		config.IntrospectionPath = "/" + strings.TrimPrefix(val.(string), "/")
+	}
+
+	if val, ok := data.GetOk("hydra_required_scopes"); ok {
+		config.RequiredScopes = val.([]string)
+	}
+
+	if val, ok := data.GetOk("hydra_required_audiences"); ok {
+		config.RequiredAudiences = val.([]string)
+	}
+
+	if val, ok := data.GetOk("hydra_subject_claim"); ok {
+		subjectClaim := val.(string)
+		if subjectClaim != hydraSubjectClaimSubject && subjectClaim != hydraSubjectClaimClientID {
+			return errors.Errorf("hydra_subject_claim must be %q or %q", hydraSubjectClaimSubject, hydraSubjectClaimClientID)
+		}
+
+		config.SubjectClaim = subjectClaim
+	}
+
+	if val, ok := data.GetOk("hydra_tls_ca_cert"); ok {
+		config.TLS.CACert = val.(string)
+	}
+
+	if val, ok := data.GetOk("hydra_tls_client_cert"); ok {
+		config.TLS.ClientCert = val.(string)
+	}
+
+	if val, ok := data.GetOk("hydra_tls_client_key"); ok {
+		config.TLS.ClientKey = val.(string)
+	}
+
+	if val, ok := data.GetOk("hydra_tls_server_name"); ok {
+		config.TLS.ServerName = val.(string)
+	}
+
+	if val, ok := data.GetOk("hydra_tls_skip_verify"); ok {
+		config.TLS.SkipVerify = val.(bool)
+	}
+
+	return nil
+}
+
+// updateJWTConfig updates the JWT configuration with the fields set in the request.
+func updateJWTConfig(config *JWTConfig, data *framework.FieldData) error {
+	if config.TLS == nil {
+		config.TLS = &TLSConfig{}
+	}
+
+	if val, ok := data.GetOk("jwt_jwks_url"); ok {
+		config.JWKSURL = ""
+
+		if val.(string) != "" {
+			jwksURL, err := parseKratosURL("jwt_jwks_url", val.(string))
+			if err != nil {
+				return err
+			}
+
+			config.JWKSURL = jwksURL
+		}
+	}
+
+	if val, ok := data.GetOk("jwt_jwks_ca_cert"); ok {
+		config.TLS.CACert = val.(string)
+	}
+
+	if val, ok := data.GetOk("jwt_public_keys"); ok {
+		config.PublicKeys = val.([]string)
+	}
+
+	if val, ok := data.GetOk("jwt_bound_issuer"); ok {
+		config.BoundIssuer = val.(string)
+	}
+
+	if val, ok := data.GetOk("jwt_bound_audiences"); ok {
+		config.BoundAudiences = val.([]string)
+	}
+
+	if val, ok := data.GetOk("jwt_leeway"); ok {
+		config.Leeway = time.Duration(val.(int)) * time.Second
+	}
+
+	if val, ok := data.GetOk("jwt_subject_claim"); ok {
+		if val.(string) == "" {
+			return errors.New("jwt_subject_claim must not be empty")
+		}
+
+		config.SubjectClaim = val.(string)
+	}
+
+	return nil
+}
+
+// updateSessionCacheConfig updates the session cache configuration with the fields set in the request.
+func updateSessionCacheConfig(config *SessionCacheConfig, data *framework.FieldData) {
+	if val, ok := data.GetOk("session_cache_size"); ok {
+		config.Size = val.(int)
+	}
+
+	if val, ok := data.GetOk("session_cache_ttl"); ok {
+		config.TTL = time.Duration(val.(int)) * time.Second
+	}
+}
+
+// updateCheckCacheConfig updates the check cache configuration with the fields set in the request.
+func updateCheckCacheConfig(config *CheckCacheConfig, data *framework.FieldData) {
+	if val, ok := data.GetOk("check_cache_size"); ok {
+		config.Size = val.(int)
+	}
+
+	if val, ok := data.GetOk("check_cache_positive_ttl"); ok {
+		config.PositiveTTL = time.Duration(val.(int)) * time.Second
+	}
+
+	if val, ok := data.GetOk("check_cache_negative_ttl"); ok {
+		config.NegativeTTL = time.Duration(val.(int)) * time.Second
+	}
+
+	if val, ok := data.GetOk("check_cache_exempt_namespaces"); ok {
+		config.ExemptNamespaces = val.([]string)
+	}
+}
+
+// updateResilienceConfig updates the timeout, retry and circuit breaker configuration with the fields set in the request.
+func updateResilienceConfig(config *ResilienceConfig, data *framework.FieldData) {
+	if val, ok := data.GetOk("upstream_timeout"); ok {
+		config.Timeout = time.Duration(val.(int)) * time.Second
+	}
+
+	if val, ok := data.GetOk("upstream_max_retries"); ok {
+		config.MaxRetries = val.(int)
+	}
+
+	if val, ok := data.GetOk("circuit_breaker_threshold"); ok {
+		config.BreakerThreshold = val.(int)
+	}
+
+	if val, ok := data.GetOk("circuit_breaker_cooldown"); ok {
+		config.BreakerCooldown = time.Duration(val.(int)) * time.Second
+	}
+}
+
+// updateTracingConfig updates the tracing configuration with the fields set in the request.
+func updateTracingConfig(config *TracingConfig, data *framework.FieldData) {
+	if val, ok := data.GetOk("tracing_otlp_endpoint"); ok {
+		config.Endpoint = val.(string)
+	}
+
+	if val, ok := data.GetOk("tracing_sample_ratio"); ok {
+		config.SampleRatio = val.(float64)
+	}
+}
+
+// updateAuditConfig updates the login audit trail configuration with the fields set in the request.
+func updateAuditConfig(config *AuditConfig, data *framework.FieldData) {
+	if val, ok := data.GetOk("audit_log_size"); ok {
+		config.Size = val.(int)
+	}
+
+	if val, ok := data.GetOk("audit_log_retention"); ok {
+		config.Retention = time.Duration(val.(int)) * time.Second
+	}
+}
+
+// updateTokenConfig updates the token lifetimes and revocation configuration with the fields set in the request.
+func updateTokenConfig(config *TokenConfig, data *framework.FieldData) {
+	if val, ok := data.GetOk("token_ttl"); ok {
+		config.TTL = time.Duration(val.(int)) * time.Second
+	}
+
+	if val, ok := data.GetOk("token_max_ttl"); ok {
+		config.MaxTTL = time.Duration(val.(int)) * time.Second
+	}
+
+	if val, ok := data.GetOk("token_period"); ok {
+		config.Period = time.Duration(val.(int)) * time.Second
+	}
+
+	if val, ok := data.GetOk("revocation_vault_addr"); ok {
+		config.RevocationAddress = val.(string)
+	}
+
+	if val, ok := data.GetOk("revocation_vault_token"); ok {
+		config.RevocationToken = val.(string)
+	}
+}
+
+// updateCIDRConfig updates the login and token bound CIDRs with the fields set in the request.
+func updateCIDRConfig(config *CIDRConfig, data *framework.FieldData) {
+	if val, ok := data.GetOk("bound_cidrs"); ok {
+		config.BoundCIDRs = val.([]string)
+	}
+
+	if val, ok := data.GetOk("token_bound_cidrs"); ok {
+		config.TokenBoundCIDRs = val.([]string)
+	}
+}
+
+// updateRateLimitConfig updates the login rate limits with the fields set in the request.
+func updateRateLimitConfig(config *RateLimitConfig, data *framework.FieldData) {
+	if val, ok := data.GetOk("rate_limit_ip"); ok {
+		config.IP = val.(int)
+	}
+
+	if val, ok := data.GetOk("rate_limit_ip_burst"); ok {
+		config.IPBurst = val.(int)
+	}
+
+	if val, ok := data.GetOk("rate_limit_session"); ok {
+		config.Session = val.(int)
+	}
+
+	if val, ok := data.GetOk("rate_limit_session_burst"); ok {
+		config.SessionBurst = val.(int)
+	}
+
+	if val, ok := data.GetOk("rate_limit_identity"); ok {
+		config.Identity = val.(int)
+	}
+
+	if val, ok := data.GetOk("rate_limit_identity_burst"); ok {
+		config.IdentityBurst = val.(int)
+	}
+}
+
+// validateConfig checks that the configuration is complete and its TLS material can be parsed.
+func validateConfig(config *Config) error {
+	if config.Kratos.publicURL() == "" {
+		return errors.New("kratos_public_url is required")
+	}
+
+	if config.Kratos.adminURL() == "" {
+		return errors.New("kratos_admin_url is required")
+	}
+
+	if config.Keto.readAddress() == "" {
+		return errors.New("keto_read_address is required")
+	}
+
+	if config.Keto.writeAddress() == "" {
+		return errors.New("keto_write_address is required")
+	}
+
+	_, err := config.Kratos.TLS.tlsConfig()
+	if err != nil {
+		return errors.Wrap(err, "invalid kratos TLS configuration")
+	}
+
+	if config.Ory.APIKey != "" && !config.Keto.TLSEnabled {
+		return errors.New("keto_tls must be enabled when ory_api_key is set")
+	}
+
+	_, err = config.Keto.TLS.tlsConfig()
+	if err != nil {
+		return errors.Wrap(err, "invalid keto TLS configuration")
+	}
+
+	_, err = config.Hydra.TLS.tlsConfig()
+	if err != nil {
+		return errors.Wrap(err, "invalid hydra TLS configuration")
+	}
+
+	if config.SessionCache.Size < 0 || config.SessionCache.TTL < 0 {
+		return errors.New("session_cache_size and session_cache_ttl must not be negative")
+	}
+
+	if config.CheckCache.Size < 0 || config.CheckCache.PositiveTTL < 0 || config.CheckCache.NegativeTTL < 0 {
+		return errors.New("check_cache_size, check_cache_positive_ttl and check_cache_negative_ttl must not be negative")
+	}
+
+	if config.CheckCache.PositiveTTL > maxCheckCachePositiveTTL {
+		return errors.Errorf("check_cache_positive_ttl must not be longer than %s", maxCheckCachePositiveTTL)
+	}
+
+	if config.Resilience.Timeout <= 0 {
+		return errors.New("upstream_timeout must be positive")
+	}
+
+	if config.Resilience.MaxRetries < 0 || config.Resilience.BreakerThreshold < 0 || config.Resilience.BreakerCooldown < 0 {
+		return errors.New("upstream_max_retries, circuit_breaker_threshold and circuit_breaker_cooldown must not be negative")
+	}
+
+	_, err = parseutil.ParseAddrs(config.CIDR.BoundCIDRs)
+	if err != nil {
+		return errors.Wrap(err, "invalid bound_cidrs")
+	}
+
+	_, err = parseutil.ParseAddrs(config.CIDR.TokenBoundCIDRs)
+	if err != nil {
+		return errors.Wrap(err, "invalid token_bound_cidrs")
+	}
+
+	if config.Audit.Size < 0 || config.Audit.Retention < 0 {
+		return errors.New("audit_log_size and audit_log_retention must not be negative")
+	}
+
+	if config.Token.TTL < 0 || config.Token.MaxTTL < 0 || config.Token.Period < 0 {
+		return errors.New("token_ttl, token_max_ttl and token_period must not be negative")
+	}
+
+	if config.Token.MaxTTL > 0 && config.Token.TTL > config.Token.MaxTTL {
+		return errors.New("token_ttl must not be longer than token_max_ttl")
+	}
+
+	if config.Token.revocationEnabled() {
+		_, err = url.ParseRequestURI(config.Token.RevocationAddress)
+		if err != nil {
+			return errors.Wrap(err, "invalid revocation_vault_addr")
+		}
+
+		if config.Token.RevocationToken == "" {
+			return errors.New("revocation_vault_token is required when revocation_vault_addr is set")
+		}
+	}
+
+	rateLimit := config.RateLimit
+	if rateLimit.IP < 0 || rateLimit.IPBurst < 0 || rateLimit.Session < 0 || rateLimit.SessionBurst < 0 ||
+		rateLimit.Identity < 0 || rateLimit.IdentityBurst < 0 {
+		return errors.New("rate limits and bursts must not be negative")
+	}
+
+	if config.Tracing.SampleRatio < 0 || config.Tracing.SampleRatio > 1 {
+		return errors.New("tracing_sample_ratio must be between 0 and 1")
+	}
+
+	if config.Tracing.Endpoint != "" {
+		_, err = tracingExporterOptions(config.Tracing.Endpoint)
+		if err != nil {
+			return errors.Wrap(err, "invalid tracing_otlp_endpoint")
+		}
+	}
+
+	if config.JWT.JWKSURL != "" && len(config.JWT.PublicKeys) > 0 {
+		return errors.New("jwt_jwks_url and jwt_public_keys are mutually exclusive")
+	}
+
+	if config.JWT.Leeway < 0 {
+		return errors.New("jwt_leeway must not be negative")
+	}
+
+	for _, publicKey := range config.JWT.PublicKeys {
+		_, err = parsePublicKeyPEM(publicKey)
+		if err != nil {
+			return errors.Wrap(err, "invalid jwt_public_keys")
+		}
+	}
+
+	_, err = config.JWT.TLS.tlsConfig()
+	if err != nil {
+		return errors.Wrap(err, "invalid jwt TLS configuration")
+	}
+
+	return nil
+}
+
+// verifyConnection builds candidate Kratos, Keto and Hydra clients from the given configuration
+// and checks that the services are reachable with them. Hydra and the JWKS are only checked if configured.
+func (b *OryAuthBackend) verifyConnection(ctx context.Context, config *Config) error {
+	b.Logger().Debug("verifying connection to ory services")
+
+	ctx, cancel := context.WithTimeout(ctx, verifyConnectionTimeout)
+	defer cancel()
+
+	kratosClient, err := newKratosClient(config, b.Logger())
+	if err != nil {
+		return errors.Wrap(err, "failed to verify kratos connection")
+	}
+
+	err = checkKratosClientHealth(ctx, kratosClient)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify kratos connection")
+	}
+
+	ketoClient, err := newKetoClient(config, b.ketoDialOptions...)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify keto connection")
+	}
+	defer ketoClient.close()
+
+	err = checkKetoClientHealth(ctx, ketoClient)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify keto connection")
+	}
+
+	hydraClient, err := newHydraClient(config)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify hydra connection")
+	}
+
+	if hydraClient != nil {
+		defer hydraClient.httpClient.CloseIdleConnections()
+
+		err = checkHydraClientHealth(ctx, hydraClient)
+		if err != nil {
+			return errors.Wrap(err, "failed to verify hydra connection")
+		}
+	}
+
+	jwtVerifier, err := newJWTVerifier(config)
+	if err != nil {
+		return errors.Wrap(err, "failed to verify jwks connection")
+	}
+
+	if jwtVerifier != nil {
+		defer jwtVerifier.httpClient.CloseIdleConnections()
+
+		err = checkJWTVerifierHealth(ctx, jwtVerifier)
+		if err != nil {
+			return errors.Wrap(err, "failed to verify jwks connection")
+		}
+	}
+
+	b.Logger().Debug("verified connection to ory services")
+
+	return nil
+}
@@ -0,0 +1,313 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"google.golang.org/grpc"
+)
+
+func TestConfigRoundTripsZeroJWTLeeway(t *testing.T) {
+	b, s := newTestBackend(t)
+
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"jwt_leeway": 0,
+	})
+
+	data := readTestConfig(t, b, s)
+	if got := data["jwt_leeway"]; got != int64(0) {
+		t.Errorf("jwt_leeway = %v, want 0", got)
+	}
+
+	config, err := b.readConfig(context.Background(), s)
+	if err != nil {
+		t.Fatalf("reading stored config: %v", err)
+	}
+
+	if config.JWT.Leeway != 0 {
+		t.Errorf("stored leeway = %s, want 0", config.JWT.Leeway)
+	}
+}
+
+func TestConfigRoundTripsZeroCacheAndBreakerSettings(t *testing.T) {
+	b, s := newTestBackend(t)
+
+	fields := []string{
+		"session_cache_size",
+		"session_cache_ttl",
+		"check_cache_size",
+		"check_cache_positive_ttl",
+		"check_cache_negative_ttl",
+		"circuit_breaker_cooldown",
+	}
+
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"session_cache_size":       512,
+		"session_cache_ttl":        30,
+		"check_cache_size":         512,
+		"check_cache_positive_ttl": 30,
+		"check_cache_negative_ttl": 5,
+		"circuit_breaker_cooldown": 10,
+	})
+
+	zeros := map[string]interface{}{}
+	for _, field := range fields {
+		zeros[field] = 0
+	}
+
+	writeTestConfig(t, b, s, zeros)
+
+	data := readTestConfig(t, b, s)
+	for _, field := range fields {
+		if got := data[field]; got != 0 && got != int64(0) {
+			t.Errorf("%s = %v, want 0", field, got)
+		}
+	}
+}
+
+// startTestKratosHealth serves a Kratos API whose liveness endpoint answers with the status code, and returns its URL.
+func startTestKratosHealth(t *testing.T, status int) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health/alive" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+// writeVerifiedTestConfig writes the configuration fields through the config path, verifying the connection.
+func writeVerifiedTestConfig(b *OryAuthBackend, s logical.Storage, data map[string]interface{}) (*logical.Response, error) {
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   s,
+		Data:      data,
+	})
+}
+
+func TestConfigWriteVerifiesConnection(t *testing.T) {
+	b, s := newTestBackend(t)
+	startTestKetoServices(t, b, func(*grpc.Server) {})
+
+	kratosURL := startTestKratosHealth(t, http.StatusOK)
+
+	res, err := writeVerifiedTestConfig(b, s, map[string]interface{}{
+		"kratos_public_url": kratosURL,
+		"kratos_admin_url":  kratosURL,
+	})
+	if err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	if res != nil && res.IsError() {
+		t.Fatalf("writing config: %v", res.Error())
+	}
+
+	if got := readTestConfig(t, b, s)["kratos_public_url"]; got != kratosURL {
+		t.Errorf("kratos_public_url = %v, want %q", got, kratosURL)
+	}
+}
+
+func TestConfigWriteRefusesUnhealthyKratos(t *testing.T) {
+	b, s := newTestBackend(t)
+	startTestKetoServices(t, b, func(*grpc.Server) {})
+
+	publicURL := startTestKratosHealth(t, http.StatusOK)
+	adminURL := startTestKratosHealth(t, http.StatusServiceUnavailable)
+
+	res, err := writeVerifiedTestConfig(b, s, map[string]interface{}{
+		"kratos_public_url": publicURL,
+		"kratos_admin_url":  adminURL,
+	})
+	if err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	if res == nil || !res.IsError() {
+		t.Fatalf("config with an unhealthy kratos admin API was saved: %v", res)
+	}
+
+	if got := res.Error().Error(); !strings.Contains(got, "kratos admin API health check failed") {
+		t.Errorf("error = %q, want the kratos admin API health check failure", got)
+	}
+
+	config, err := b.readConfig(context.Background(), s)
+	if err != nil {
+		t.Fatalf("reading stored config: %v", err)
+	}
+
+	if config != nil {
+		t.Error("config was stored despite the failed verification")
+	}
+}
+
+func TestConfigWriteRefusesUnreachableKeto(t *testing.T) {
+	b, s := newTestBackend(t)
+
+	kratosURL := startTestKratosHealth(t, http.StatusOK)
+
+	res, err := writeVerifiedTestConfig(b, s, map[string]interface{}{
+		"kratos_public_url": kratosURL,
+		"kratos_admin_url":  kratosURL,
+		"keto_read_address": "127.0.0.1:1",
+	})
+	if err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	if res == nil || !res.IsError() {
+		t.Fatalf("config with an unreachable keto read API was saved: %v", res)
+	}
+
+	if got := res.Error().Error(); !strings.Contains(got, "keto read API health check failed") {
+		t.Errorf("error = %q, want the keto read API health check failure", got)
+	}
+}
+
+func TestConfigReadRedactsSensitiveFields(t *testing.T) {
+	b, s := newTestBackend(t)
+
+	cert, key := testCertificate(t)
+
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"kratos_public_url":      "http://kratos.example.com:4433",
+		"kratos_default_headers": map[string]interface{}{"Authorization": "Bearer secret"},
+		"kratos_tls_client_cert": cert,
+		"kratos_tls_client_key":  key,
+		"keto_tls":               true,
+		"keto_tls_client_cert":   cert,
+		"keto_tls_client_key":    key,
+		"hydra_admin_url":        "http://hydra.example.com:4445",
+		"hydra_tls_client_cert":  cert,
+		"hydra_tls_client_key":   key,
+		"ory_api_key":            "ory_pat_secret",
+		"revocation_vault_addr":  "https://127.0.0.1:8200",
+		"revocation_vault_token": "revocation-token",
+	})
+
+	data := readTestConfig(t, b, s)
+
+	if got := data["kratos_public_url"]; got != "http://kratos.example.com:4433" {
+		t.Errorf("kratos_public_url = %v, want http://kratos.example.com:4433", got)
+	}
+
+	if got := data["kratos_tls_client_cert"]; got != cert {
+		t.Errorf("kratos_tls_client_cert = %v, want the certificate", got)
+	}
+
+	for _, field := range []string{
+		"kratos_default_headers",
+		"kratos_tls_client_key",
+		"keto_tls_client_key",
+		"hydra_tls_client_key",
+		"ory_api_key",
+		"revocation_vault_token",
+	} {
+		if _, ok := data[field]; ok {
+			t.Errorf("sensitive field %s returned on read", field)
+		}
+	}
+
+	config, err := b.readConfig(context.Background(), s)
+	if err != nil {
+		t.Fatalf("reading stored config: %v", err)
+	}
+
+	if config.Ory.APIKey != "ory_pat_secret" || config.Kratos.TLS.ClientKey != key {
+		t.Error("sensitive fields were not stored")
+	}
+}
+
+func TestConfigExistenceCheckAndDelete(t *testing.T) {
+	b, s := newTestBackend(t)
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   s,
+	}
+
+	checkFound, exists, err := b.HandleExistenceCheck(context.Background(), req)
+	if err != nil {
+		t.Fatalf("checking existence: %v", err)
+	}
+
+	if !checkFound || exists {
+		t.Fatalf("existence check before write = (%t, %t), want (true, false)", checkFound, exists)
+	}
+
+	writeTestConfig(t, b, s, map[string]interface{}{})
+
+	_, exists, err = b.HandleExistenceCheck(context.Background(), req)
+	if err != nil {
+		t.Fatalf("checking existence: %v", err)
+	}
+
+	if !exists {
+		t.Fatal("config does not exist after write")
+	}
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "config",
+		Storage:   s,
+	})
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("deleting config: %v %v", res, err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config",
+		Storage:   s,
+	})
+	if err != nil {
+		t.Fatalf("reading config: %v", err)
+	}
+
+	if res != nil {
+		t.Errorf("read after delete = %v, want no response", res)
+	}
+}
+
+func TestConfigWriteRejectsInvalidFields(t *testing.T) {
+	b, s := newTestBackend(t)
+
+	for field, value := range map[string]interface{}{
+		"kratos_public_url": "kratos.example.com",
+		"ory_api_key":       "not-a-project-key",
+	} {
+		res, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "config",
+			Storage:   s,
+			Data: map[string]interface{}{
+				field:               value,
+				"verify_connection": false,
+			},
+		})
+		if err != nil {
+			t.Fatalf("writing %s: %v", field, err)
+		}
+
+		if res == nil || !res.IsError() {
+			t.Errorf("invalid %s accepted: %v", field, res)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// denyIdentitiesSynopsis is used to provide a short summary of the denied identities path.
+	denyIdentitiesSynopsis = `Denies logins of Kratos identities.`
+
+	// denyIdentitiesDescription is used to provide a detailed description of the denied identities path.
+	denyIdentitiesDescription = `
+Adds, reads, lists and removes denied identities. Logins of a denied Kratos
+identity ID, or of any other Keto subject such as an OAuth2 client ID, are
+rejected before Keto is checked, whatever credential they use, renewals of
+their tokens are refused, and their tokens are revoked periodically if
+'revocation_vault_addr' is configured. An entry takes effect immediately, and
+is removed once it expires, if it has a 'ttl'.
+`
+
+	// denySessionsSynopsis is used to provide a short summary of the denied sessions path.
+	denySessionsSynopsis = `Denies logins with Kratos sessions.`
+
+	// denySessionsDescription is used to provide a detailed description of the denied sessions path.
+	denySessionsDescription = `
+Adds, reads, lists and removes denied sessions. Logins with the session
+cookie of a denied Kratos session ID are rejected before Keto is checked,
+including sessions already in the session cache, renewals of tokens issued
+with them are refused, and those tokens are revoked periodically if
+'revocation_vault_addr' is configured. An entry takes effect immediately, and
+is removed once it expires, if it has a 'ttl'.
+`
+
+	// denyIdentityStoragePrefix is the storage prefix of denied identities, keyed by identity ID.
+	denyIdentityStoragePrefix = "deny/identity/"
+
+	// denySessionStoragePrefix is the storage prefix of denied sessions, keyed by session ID.
+	denySessionStoragePrefix = "deny/session/"
+)
+
+// denyEntry is a stored denied identity or session.
+type denyEntry struct {
+	Reason    string     `json:"reason,omitempty"`
+	DeniedBy  string     `json:"denied_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// expired reports whether the entry has expired.
+func (e *denyEntry) expired() bool {
+	return e.ExpiresAt != nil && !time.Now().Before(*e.ExpiresAt)
+}
+
+// denyFields returns the fields of a deny list path, whose entries are identified by the ID field.
+func denyFields(idField string, idDescription string) map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		idField: {
+			Type:        framework.TypeString,
+			Description: idDescription,
+		},
+		"reason": {
+			Type:        framework.TypeString,
+			Description: "Reason the entry was added, for operators.",
+		},
+		"ttl": {
+			Type:        framework.TypeDurationSecond,
+			Description: "Time the entry is in effect for. Defaults to 0, which keeps it until it is removed.",
+		},
+	}
+}
+
+// NewPathDeny returns the paths for managing denied identities and sessions.
+func NewPathDeny(b *OryAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "deny/identities/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.listDenyHandler(denyIdentityStoragePrefix),
+			},
+			HelpSynopsis:    denyIdentitiesSynopsis,
+			HelpDescription: denyIdentitiesDescription,
+		},
+		{
+			Pattern: "deny/identities/" + framework.MatchAllRegex("identity_id"),
+			Fields:  denyFields("identity_id", "Kratos identity ID, or other Keto subject, to deny logins of."),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.readDenyHandler(denyIdentityStoragePrefix, "identity_id"),
+				logical.UpdateOperation: b.writeDenyHandler(denyIdentityStoragePrefix, "identity_id"),
+				logical.DeleteOperation: b.deleteDenyHandler(denyIdentityStoragePrefix, "identity_id"),
+			},
+			HelpSynopsis:    denyIdentitiesSynopsis,
+			HelpDescription: denyIdentitiesDescription,
+		},
+		{
+			Pattern: "deny/sessions/?$",
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.listDenyHandler(denySessionStoragePrefix),
+			},
+			HelpSynopsis:    denySessionsSynopsis,
+			HelpDescription: denySessionsDescription,
+		},
+		{
+			Pattern: "deny/sessions/" + framework.MatchAllRegex("session_id"),
+			Fields:  denyFields("session_id", "Kratos session ID to deny logins with."),
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.readDenyHandler(denySessionStoragePrefix, "session_id"),
+				logical.UpdateOperation: b.writeDenyHandler(denySessionStoragePrefix, "session_id"),
+				logical.DeleteOperation: b.deleteDenyHandler(denySessionStoragePrefix, "session_id"),
+			},
+			HelpSynopsis:    denySessionsSynopsis,
+			HelpDescription: denySessionsDescription,
+		},
+	}
+}
+
+// listDenyHandler returns the handler listing the IDs of the deny list under the storage prefix.
+func (b *OryAuthBackend) listDenyHandler(prefix string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+		keys, err := req.Storage.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		return logical.ListResponse(keys), nil
+	}
+}
+
+// readDenyHandler returns the handler reading an entry of the deny list under the storage prefix.
+func (b *OryAuthBackend) readDenyHandler(prefix string, idField string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		entry, err := readDenyEntry(ctx, req.Storage, prefix, data.Get(idField).(string))
+		if err != nil {
+			return nil, err
+		}
+
+		if entry == nil {
+			return nil, nil
+		}
+
+		resData := map[string]interface{}{
+			idField:      data.Get(idField).(string),
+			"reason":     entry.Reason,
+			"denied_by":  entry.DeniedBy,
+			"created_at": entry.CreatedAt.Format(time.RFC3339),
+			"expires_at": "",
+		}
+
+		if entry.ExpiresAt != nil {
+			resData["expires_at"] = entry.ExpiresAt.Format(time.RFC3339)
+		}
+
+		return &logical.Response{Data: resData}, nil
+	}
+}
+
+// writeDenyHandler returns the handler adding or replacing an entry of the deny list under the storage prefix.
+func (b *OryAuthBackend) writeDenyHandler(prefix string, idField string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		id := data.Get(idField).(string)
+		if id == "" {
+			return logical.ErrorResponse("%s is required", idField), nil
+		}
+
+		if strings.Contains(id, "/") {
+			return logical.ErrorResponse("%s must not contain '/'", idField), nil
+		}
+
+		ttl := time.Duration(data.Get("ttl").(int)) * time.Second
+		if ttl < 0 {
+			return logical.ErrorResponse("ttl must not be negative"), nil
+		}
+
+		entry := &denyEntry{
+			Reason:    data.Get("reason").(string),
+			DeniedBy:  req.DisplayName,
+			CreatedAt: time.Now().UTC(),
+		}
+
+		if ttl > 0 {
+			expiresAt := entry.CreatedAt.Add(ttl)
+			entry.ExpiresAt = &expiresAt
+		}
+
+		storageEntry, err := logical.StorageEntryJSON(prefix+id, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		err = req.Storage.Put(ctx, storageEntry)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Logger().Info("added deny list entry", idField, id, "reason", entry.Reason, "denied_by", entry.DeniedBy)
+
+		return nil, nil
+	}
+}
+
+// deleteDenyHandler returns the handler removing an entry of the deny list under the storage prefix.
+func (b *OryAuthBackend) deleteDenyHandler(prefix string, idField string) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		id := data.Get(idField).(string)
+
+		err := req.Storage.Delete(ctx, prefix+id)
+		if err != nil {
+			return nil, err
+		}
+
+		b.Logger().Info("removed deny list entry", idField, id, "removed_by", req.DisplayName)
+
+		return nil, nil
+	}
+}
+
+// readDenyEntry reads an entry of the deny list under the storage prefix.
+// It returns nil if the ID is not denied or its entry has expired.
+func readDenyEntry(ctx context.Context, s logical.Storage, prefix string, id string) (*denyEntry, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	storageEntry, err := s.Get(ctx, prefix+id)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read deny list entry")
+	}
+
+	if storageEntry == nil {
+		return nil, nil
+	}
+
+	entry := &denyEntry{}
+	err = storageEntry.DecodeJSON(entry)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode deny list entry")
+	}
+
+	if entry.expired() {
+		return nil, nil
+	}
+
+	return entry, nil
+}
+
+// checkDenied returns a permission denied error if the principal's subject or session is denied.
+func (b *OryAuthBackend) checkDenied(ctx context.Context, s logical.Storage, principal *loginPrincipal) error {
+	entry, err := readDenyEntry(ctx, s, denyIdentityStoragePrefix, principal.Subject)
+	if err != nil {
+		return err
+	}
+
+	if entry != nil {
+		b.Logger().Info("rejected login of denied identity", "identity_id", principal.Subject, "reason", entry.Reason)
+
+		return permissionDeniedError(errors.New("identity is denied"))
+	}
+
+	entry, err = readDenyEntry(ctx, s, denySessionStoragePrefix, principal.SessionID)
+	if err != nil {
+		return err
+	}
+
+	if entry != nil {
+		b.Logger().Info("rejected login with denied session", "session_id", principal.SessionID, "reason", entry.Reason)
+
+		return permissionDeniedError(errors.New("session is denied"))
+	}
+
+	return nil
+}
+
+// cleanupDenyLists deletes expired entries of the identity and session deny lists from the storage.
+func (b *OryAuthBackend) cleanupDenyLists(ctx context.Context, s logical.Storage) error {
+	for _, prefix := range []string{denyIdentityStoragePrefix, denySessionStoragePrefix} {
+		keys, err := s.List(ctx, prefix)
+		if err != nil {
+			return errors.Wrap(err, "failed to list deny list entries")
+		}
+
+		for _, key := range keys {
+			storageEntry, err := s.Get(ctx, prefix+key)
+			if err != nil {
+				return errors.Wrap(err, "failed to read deny list entry")
+			}
+
+			if storageEntry == nil {
+				continue
+			}
+
+			entry := &denyEntry{}
+			err = storageEntry.DecodeJSON(entry)
+			if err != nil || !entry.expired() {
+				continue
+			}
+
+			err = s.Delete(ctx, prefix+key)
+			if err != nil {
+				return errors.Wrap(err, "failed to delete expired deny list entry")
+			}
+		}
+	}
+
+	return nil
+}
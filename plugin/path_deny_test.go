@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestDenyIdentityWithSubjectSetCharacters(t *testing.T) {
+	b, s := newTestBackend(t)
+
+	const subject = "groups:admins#member|ops"
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "deny/identities/" + subject,
+		Storage:   s,
+		Data:      map[string]interface{}{"reason": "test"},
+	})
+	if err != nil || (res != nil && res.IsError()) {
+		t.Fatalf("denying subject: %v %v", res, err)
+	}
+
+	res, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "deny/identities/" + subject,
+		Storage:   s,
+	})
+	if err != nil || res == nil || res.Data["identity_id"] != subject {
+		t.Fatalf("reading denied subject: %v %v", res, err)
+	}
+}
+
+func TestAuthRenewChecksDenyLists(t *testing.T) {
+	b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+
+	res, err := testLogin(b, s, "reports")
+	if err != nil || res == nil || res.Auth == nil {
+		t.Fatalf("login: %v %v", res, err)
+	}
+
+	auth := res.Auth
+
+	if _, err := renewTestToken(b, s, auth); err != nil {
+		t.Fatalf("renewal of a token that is not denied failed: %v", err)
+	}
+
+	for _, path := range []string{"deny/sessions/session-alice", "deny/identities/alice"} {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   s,
+		})
+		if err != nil {
+			t.Fatalf("writing %s: %v", path, err)
+		}
+
+		if _, err := renewTestToken(b, s, auth); loginErrorCode(err) != loginErrorPermissionDenied {
+			t.Errorf("renewal after writing %s returned %v, want permission denied", path, err)
+		}
+
+		_, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.DeleteOperation,
+			Path:      path,
+			Storage:   s,
+		})
+		if err != nil {
+			t.Fatalf("deleting %s: %v", path, err)
+		}
+	}
+}
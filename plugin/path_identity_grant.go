@@ -0,0 +1,275 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// identityGrantSynopsis is used to provide a short summary of the identity grant path.
+	identityGrantSynopsis = `Issues single-use grants to log in on behalf of a Kratos identity.`
+
+	// identityGrantDescription is used to provide a detailed description of the identity grant path.
+	identityGrantDescription = `
+Issues a short-lived, single-use identity grant for a Kratos identity ID.
+A trusted service authenticated to Vault, with a policy allowing this path,
+exchanges the grant at the login endpoint for a token of the identity,
+without holding a browser session. The identity is looked up with the Kratos
+admin API and the usual Keto checks apply at login.
+The grant can be scoped to a namespace, object and relation.
+`
+
+	// identityGrantStoragePrefix is the storage prefix of identity grants, keyed by the grant's hash.
+	identityGrantStoragePrefix = "identity-grant/"
+
+	// defaultIdentityGrantTTL is the TTL of identity grants when none is requested.
+	defaultIdentityGrantTTL = 1 * time.Minute
+
+	// maxIdentityGrantTTL is the maximum TTL of identity grants.
+	maxIdentityGrantTTL = 10 * time.Minute
+)
+
+// identityGrant is a stored grant to log in on behalf of a Kratos identity.
+type identityGrant struct {
+	IdentityID string    `json:"identity_id"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Object     string    `json:"object,omitempty"`
+	Relation   string    `json:"relation,omitempty"`
+	GrantedBy  string    `json:"granted_by,omitempty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// NewPathIdentityGrant returns the path for issuing identity grants.
+func NewPathIdentityGrant(b *OryAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "identity/grant$",
+			Fields: map[string]*framework.FieldSchema{
+				"identity_id": {
+					Type:        framework.TypeString,
+					Description: "Kratos identity ID the grant logs in as.",
+				},
+				"namespace": {
+					Type:        framework.TypeString,
+					Description: "If set, the grant can only be used to log in with this Keto namespace.",
+				},
+				"object": {
+					Type:        framework.TypeString,
+					Description: "If set, the grant can only be used to log in with this Keto object.",
+				},
+				"relation": {
+					Type:        framework.TypeString,
+					Description: "If set, the grant can only be used to log in with this Keto relation.",
+				},
+				"ttl": {
+					Type:        framework.TypeDurationSecond,
+					Default:     int(defaultIdentityGrantTTL.Seconds()),
+					Description: "Time the grant is valid for. Defaults to 1 minute, with a maximum of 10 minutes.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.identityGrantHandler,
+			},
+			HelpSynopsis:    identityGrantSynopsis,
+			HelpDescription: identityGrantDescription,
+		},
+	}
+}
+
+// identityGrantHandler issues an identity grant for an active Kratos identity.
+func (b *OryAuthBackend) identityGrantHandler(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	identityID := data.Get("identity_id").(string)
+	if identityID == "" {
+		return logical.ErrorResponse("identity_id is required"), nil
+	}
+
+	ttl := time.Duration(data.Get("ttl").(int)) * time.Second
+	if ttl <= 0 || ttl > maxIdentityGrantTTL {
+		return logical.ErrorResponse("ttl must be between 1 second and %s", maxIdentityGrantTTL), nil
+	}
+
+	identity, err := b.getKratosIdentity(ctx, req.Storage, identityID)
+	if err != nil {
+		if loginErrorCode(err) == loginErrorUnauthenticated {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		return nil, err
+	}
+
+	grantID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to generate identity grant")
+	}
+
+	grant := &identityGrant{
+		IdentityID: identity.Id,
+		Namespace:  data.Get("namespace").(string),
+		Object:     data.Get("object").(string),
+		Relation:   data.Get("relation").(string),
+		GrantedBy:  req.DisplayName,
+		ExpiresAt:  time.Now().Add(ttl),
+	}
+
+	entry, err := logical.StorageEntryJSON(identityGrantStorageKey(grantID), grant)
+	if err != nil {
+		return nil, err
+	}
+
+	err = req.Storage.Put(ctx, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	b.Logger().Info("issued identity grant", "identity_id", grant.IdentityID, "granted_by", grant.GrantedBy)
+
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			"identity_grant": grantID,
+			"identity_id":    grant.IdentityID,
+			"expires_at":     grant.ExpiresAt.Format(time.RFC3339),
+		},
+	}
+
+	return res, nil
+}
+
+// identityGrantPrincipal consumes the identity grant and returns the principal of its identity.
+// The grant is deleted whether or not it is valid for the requested namespace, object and relation.
+func (b *OryAuthBackend) identityGrantPrincipal(
+	ctx context.Context,
+	req *logical.Request,
+	grantID string,
+	namespace string,
+	object string,
+	relation string,
+) (*loginPrincipal, error) {
+	if grantID == "" {
+		return nil, invalidRequestError(errors.New("missing identity_grant"))
+	}
+
+	grant, err := b.consumeIdentityGrant(ctx, req.Storage, grantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if grant == nil || time.Now().After(grant.ExpiresAt) {
+		return nil, unauthenticatedError(errors.New("invalid or expired identity_grant"))
+	}
+
+	if (grant.Namespace != "" && grant.Namespace != namespace) ||
+		(grant.Object != "" && grant.Object != object) ||
+		(grant.Relation != "" && grant.Relation != relation) {
+		return nil, permissionDeniedError(errors.New("identity_grant is not valid for the namespace, object and relation"))
+	}
+
+	identity, err := b.getKratosIdentity(ctx, req.Storage, grant.IdentityID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &loginPrincipal{
+		Subject: identity.Id,
+		Metadata: map[string]string{
+			"granted_by": grant.GrantedBy,
+		},
+	}, nil
+}
+
+// consumeIdentityGrant reads and deletes the identity grant from the storage.
+// Grants are only consumed on the active node, so the mutex makes them single-use across the cluster:
+// on a performance standby, logical.ErrReadOnly is returned without reading the grant,
+// which may not have been replicated yet, and Vault forwards the login to the active node.
+func (b *OryAuthBackend) consumeIdentityGrant(
+	ctx context.Context,
+	s logical.Storage,
+	grantID string,
+) (*identityGrant, error) {
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return nil, logical.ErrReadOnly
+	}
+
+	b.identityGrantMutex.Lock()
+	defer b.identityGrantMutex.Unlock()
+
+	key := identityGrantStorageKey(grantID)
+
+	entry, err := s.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry == nil {
+		return nil, nil
+	}
+
+	err = s.Delete(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	grant := &identityGrant{}
+	err = entry.DecodeJSON(grant)
+	if err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+// cleanupIdentityGrants deletes expired identity grants from the storage.
+func (b *OryAuthBackend) cleanupIdentityGrants(ctx context.Context, s logical.Storage) error {
+	keys, err := s.List(ctx, identityGrantStoragePrefix)
+	if err != nil {
+		return errors.Wrap(err, "failed to list identity grants")
+	}
+
+	b.identityGrantMutex.Lock()
+	defer b.identityGrantMutex.Unlock()
+
+	for _, key := range keys {
+		entry, err := s.Get(ctx, identityGrantStoragePrefix+key)
+		if err != nil {
+			return errors.Wrap(err, "failed to read identity grant")
+		}
+
+		if entry == nil {
+			continue
+		}
+
+		grant := &identityGrant{}
+		err = entry.DecodeJSON(grant)
+		if err == nil && time.Now().Before(grant.ExpiresAt) {
+			continue
+		}
+
+		err = s.Delete(ctx, identityGrantStoragePrefix+key)
+		if err != nil {
+			return errors.Wrap(err, "failed to delete expired identity grant")
+		}
+	}
+
+	return nil
+}
+
+// identityGrantStorageKey returns the storage key of an identity grant.
+// Grants are stored by hash, so the storage does not hold usable grants.
+func identityGrantStorageKey(grantID string) string {
+	hash := sha256.Sum256([]byte(strings.TrimSpace(grantID)))
+
+	return identityGrantStoragePrefix + hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,241 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// newTestGrantBackend returns a backend created with the backend configuration,
+// configured to issue and exchange identity grants against an in-process Kratos and Keto.
+func newTestGrantBackend(t *testing.T, conf *logical.BackendConfig) (*OryAuthBackend, logical.Storage) {
+	t.Helper()
+
+	b, s := newTestBackendWithConfig(t, conf)
+	startTestKeto(t, b, &testKetoCheckServer{})
+
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"kratos_public_url": startTestKratos(t, "alice"),
+		"kratos_admin_url":  startTestKratosAdmin(t, "alice", "active"),
+	})
+
+	return b, s
+}
+
+// newTestGrantBackendConfig returns a backend configuration with in-memory storage.
+func newTestGrantBackendConfig() *logical.BackendConfig {
+	conf := logical.TestBackendConfig()
+	conf.StorageView = &logical.InmemStorage{}
+
+	return conf
+}
+
+// testIdentityGrant issues an identity grant for the identity with the given fields.
+func testIdentityGrant(t *testing.T, b *OryAuthBackend, s logical.Storage, fields map[string]interface{}) string {
+	t.Helper()
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "identity/grant",
+		Storage:     s,
+		DisplayName: "token-billing-service",
+		Data:        fields,
+	})
+	if err != nil || res == nil || res.IsError() {
+		t.Fatalf("issuing identity grant: %v %v", res, err)
+	}
+
+	return res.Data["identity_grant"].(string)
+}
+
+// testGrantLogin logs in with the identity grant for the relation to the object.
+func testGrantLogin(b *OryAuthBackend, s logical.Storage, grant string, object string) (*logical.Response, error) {
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "login",
+		Storage:    s,
+		Connection: &logical.Connection{RemoteAddr: "127.0.0.1"},
+		Data: map[string]interface{}{
+			"namespace":      "files",
+			"object":         object,
+			"relation":       "view",
+			"identity_grant": grant,
+		},
+	})
+}
+
+func TestIdentityGrantIsSingleUse(t *testing.T) {
+	b, s := newTestGrantBackend(t, newTestGrantBackendConfig())
+
+	grant := testIdentityGrant(t, b, s, map[string]interface{}{"identity_id": "alice"})
+
+	res, err := testGrantLogin(b, s, grant, "reports")
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+
+	if res == nil || res.Auth == nil {
+		t.Fatalf("login issued no auth: %v", res)
+	}
+
+	if got := res.Auth.Alias.Metadata["granted_by"]; got != "token-billing-service" {
+		t.Errorf("granted_by = %q, want token-billing-service", got)
+	}
+
+	if got := res.Auth.InternalData["subject"]; got != "alice" {
+		t.Errorf("subject = %v, want alice", got)
+	}
+
+	res, err = testGrantLogin(b, s, grant, "reports")
+	if err != nil {
+		t.Fatalf("logging in again: %v", err)
+	}
+
+	assertLoginErrorResponse(t, res, http.StatusUnauthorized, loginErrorUnauthenticated)
+}
+
+func TestIdentityGrantIsScoped(t *testing.T) {
+	b, s := newTestGrantBackend(t, newTestGrantBackendConfig())
+
+	grant := testIdentityGrant(t, b, s, map[string]interface{}{
+		"identity_id": "alice",
+		"namespace":   "files",
+		"object":      "budgets",
+	})
+
+	res, err := testGrantLogin(b, s, grant, "reports")
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+
+	assertLoginErrorResponse(t, res, http.StatusForbidden, loginErrorPermissionDenied)
+
+	// The grant is consumed by the rejected login.
+	res, err = testGrantLogin(b, s, grant, "budgets")
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+
+	assertLoginErrorResponse(t, res, http.StatusUnauthorized, loginErrorUnauthenticated)
+}
+
+func TestIdentityGrantHandlerErrors(t *testing.T) {
+	b, s := newTestGrantBackend(t, newTestGrantBackendConfig())
+
+	for name, data := range map[string]map[string]interface{}{
+		"missing identity": {},
+		"ttl too long":     {"identity_id": "alice", "ttl": "1h"},
+		"unknown identity": {"identity_id": "bob"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			res, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "identity/grant",
+				Storage:   s,
+				Data:      data,
+			})
+			if err != nil {
+				t.Fatalf("issuing identity grant: %v", err)
+			}
+
+			if res == nil || !res.IsError() {
+				t.Errorf("expected an error response, got %v", res)
+			}
+		})
+	}
+}
+
+func TestExpiredIdentityGrantsAreRejectedAndCleanedUp(t *testing.T) {
+	b, s := newTestGrantBackend(t, newTestGrantBackendConfig())
+
+	for _, grantID := range []string{"expired-1", "expired-2"} {
+		entry, err := logical.StorageEntryJSON(identityGrantStorageKey(grantID), &identityGrant{
+			IdentityID: "alice",
+			ExpiresAt:  time.Now().Add(-time.Second),
+		})
+		if err != nil {
+			t.Fatalf("encoding grant: %v", err)
+		}
+
+		err = s.Put(context.Background(), entry)
+		if err != nil {
+			t.Fatalf("storing grant: %v", err)
+		}
+	}
+
+	testIdentityGrant(t, b, s, map[string]interface{}{"identity_id": "alice"})
+
+	res, err := testGrantLogin(b, s, "expired-1", "reports")
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+
+	assertLoginErrorResponse(t, res, http.StatusUnauthorized, loginErrorUnauthenticated)
+
+	err = b.cleanupIdentityGrants(context.Background(), s)
+	if err != nil {
+		t.Fatalf("cleaning up grants: %v", err)
+	}
+
+	keys, err := s.List(context.Background(), identityGrantStoragePrefix)
+	if err != nil {
+		t.Fatalf("listing grants: %v", err)
+	}
+
+	if len(keys) != 1 {
+		t.Errorf("%d grants left after cleanup, want the unexpired one", len(keys))
+	}
+}
+
+func TestIdentityGrantLoginIsForwardedFromPerformanceStandby(t *testing.T) {
+	conf := newTestGrantBackendConfig()
+	conf.System = &logical.StaticSystemView{
+		DefaultLeaseTTLVal:  24 * time.Hour,
+		MaxLeaseTTLVal:      24 * 2 * time.Hour,
+		ReplicationStateVal: consts.ReplicationPerformanceStandby,
+	}
+
+	b, s := newTestGrantBackend(t, conf)
+
+	grant := testIdentityGrant(t, b, s, map[string]interface{}{"identity_id": "alice"})
+
+	_, err := testGrantLogin(b, s, grant, "reports")
+	if !errors.Is(err, logical.ErrReadOnly) {
+		t.Fatalf("login error = %v, want %v", err, logical.ErrReadOnly)
+	}
+
+	entry, err := s.Get(context.Background(), identityGrantStorageKey(grant))
+	if err != nil {
+		t.Fatalf("reading grant: %v", err)
+	}
+
+	if entry == nil {
+		t.Error("grant was consumed on the standby")
+	}
+}
+
+// readOnlyDeleteStorage is storage whose deletes fail as they do on a performance standby.
+type readOnlyDeleteStorage struct {
+	logical.Storage
+}
+
+// Delete returns logical.ErrReadOnly.
+func (readOnlyDeleteStorage) Delete(context.Context, string) error {
+	return logical.ErrReadOnly
+}
+
+func TestIdentityGrantLoginReturnsReadOnlyStorageErrors(t *testing.T) {
+	b, s := newTestGrantBackend(t, newTestGrantBackendConfig())
+
+	grant := testIdentityGrant(t, b, s, map[string]interface{}{"identity_id": "alice"})
+
+	_, err := testGrantLogin(b, readOnlyDeleteStorage{Storage: s}, grant, "reports")
+	if !errors.Is(err, logical.ErrReadOnly) {
+		t.Fatalf("login error = %v, want %v", err, logical.ErrReadOnly)
+	}
+}
@@ -0,0 +1,197 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	keto "github.com/ory/keto/proto/ory/keto/relation_tuples/v1alpha2"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// ketoExplainSynopsis is used to provide a short summary of the Keto explain path.
+	ketoExplainSynopsis = `Explains Ory Keto permissions by expanding a subject set.`
+
+	// ketoExplainDescription is used to provide a detailed description of the Keto explain path.
+	ketoExplainDescription = `
+Expands the subject set namespace:object#relation with the Keto expand API and
+returns the resulting subject tree, limited to 'max_depth' levels.
+If 'subject' is given, the response also reports whether the subject is reachable
+in the returned tree and whether Keto's check API allows it, which helps to debug
+denied logins.
+`
+)
+
+// NewPathKetoExplain returns the path for explaining Keto permissions.
+func NewPathKetoExplain(b *OryAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "keto/explain$",
+			Fields: map[string]*framework.FieldSchema{
+				"namespace": {
+					Type:        framework.TypeString,
+					Description: "Keto namespace of the subject set to expand.",
+				},
+				"object": {
+					Type:        framework.TypeString,
+					Description: "Keto object of the subject set to expand.",
+				},
+				"relation": {
+					Type:        framework.TypeString,
+					Description: "Keto relation of the subject set to expand.",
+				},
+				"subject": {
+					Type:        framework.TypeString,
+					Description: "Optional subject ID, or subject set in the format namespace:object#relation, to look for.",
+				},
+				"max_depth": {
+					Type: framework.TypeInt,
+					Description: `Maximum depth of the subject tree.
+If less than 1 or greater than Keto's global max-depth, Keto's global max-depth is used.`,
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.ketoExplainHandler,
+				logical.UpdateOperation: b.ketoExplainHandler,
+			},
+			HelpSynopsis:    ketoExplainSynopsis,
+			HelpDescription: ketoExplainDescription,
+		},
+	}
+}
+
+// ketoExplainHandler expands the requested subject set and reports whether the subject is reachable.
+func (b *OryAuthBackend) ketoExplainHandler(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	namespace, err := b.getNamespace(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	object, err := b.getObject(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	relation, err := b.getRelation(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	maxDepth := int32(data.Get("max_depth").(int))
+
+	ketoClient, err := b.getKetoClient(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	defer ketoClient.release()
+
+	res, err := ketoClient.ExpandServiceClient.Expand(
+		ctx,
+		&keto.ExpandRequest{
+			Subject:  keto.NewSubjectSet(namespace, object, relation),
+			MaxDepth: maxDepth,
+		},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to expand keto subject set")
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"namespace": namespace,
+			"object":    object,
+			"relation":  relation,
+			"max_depth": maxDepth,
+			"tree":      subjectTreeToMap(res.GetTree()),
+		},
+	}
+
+	subject := data.Get("subject").(string)
+	if subject == "" {
+		return resp, nil
+	}
+
+	parsedSubject, err := parseSubject(subject)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	checkRes, err := ketoClient.CheckServiceClient.Check(
+		ctx,
+		newCheckRequest(&keto.RelationTuple{
+			Namespace: namespace,
+			Object:    object,
+			Relation:  relation,
+			Subject:   parsedSubject,
+		}, maxDepth, nil),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check keto relation")
+	}
+
+	resp.Data["subject"] = formatSubject(parsedSubject)
+	resp.Data["subject_reachable"] = subjectTreeContains(res.GetTree(), formatSubject(parsedSubject))
+	resp.Data["allowed"] = checkRes.GetAllowed()
+
+	return resp, nil
+}
+
+// subjectTreeSubject returns the subject of a subject tree node.
+func subjectTreeSubject(tree *keto.SubjectTree) *keto.Subject {
+	if tuple := tree.GetTuple(); tuple != nil && tuple.GetSubject() != nil {
+		return tuple.GetSubject()
+	}
+
+	// Keto versions before v0.10 only set the deprecated subject field.
+	return tree.GetSubject()
+}
+
+// subjectTreeToMap converts a subject tree to a map for the response.
+func subjectTreeToMap(tree *keto.SubjectTree) map[string]interface{} {
+	if tree == nil {
+		return nil
+	}
+
+	node := map[string]interface{}{
+		"type":    strings.TrimPrefix(strings.ToLower(tree.GetNodeType().String()), "node_type_"),
+		"subject": formatSubject(subjectTreeSubject(tree)),
+	}
+
+	if len(tree.GetChildren()) > 0 {
+		children := make([]map[string]interface{}, 0, len(tree.GetChildren()))
+		for _, child := range tree.GetChildren() {
+			children = append(children, subjectTreeToMap(child))
+		}
+
+		node["children"] = children
+	}
+
+	return node
+}
+
+// subjectTreeContains reports whether the formatted subject appears anywhere in the subject tree.
+func subjectTreeContains(tree *keto.SubjectTree, subject string) bool {
+	if tree == nil {
+		return false
+	}
+
+	if formatSubject(subjectTreeSubject(tree)) == subject {
+		return true
+	}
+
+	for _, child := range tree.GetChildren() {
+		if subjectTreeContains(child, subject) {
+			return true
+		}
+	}
+
+	return false
+}
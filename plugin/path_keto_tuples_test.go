@@ -0,0 +1,269 @@
+package plugin
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+
+	keto "github.com/ory/keto/proto/ory/keto/relation_tuples/v1alpha2"
+
+	"google.golang.org/grpc"
+)
+
+// testKetoTupleServer is a Keto read, write and check service backed by an in-memory set of relation tuples.
+// Checks only match tuples with the checked subject ID directly.
+type testKetoTupleServer struct {
+	keto.UnimplementedCheckServiceServer
+	keto.UnimplementedReadServiceServer
+	keto.UnimplementedWriteServiceServer
+
+	mutex  sync.Mutex
+	tuples []*keto.RelationTuple
+}
+
+// register registers the services of the server.
+func (s *testKetoTupleServer) register(server *grpc.Server) {
+	keto.RegisterCheckServiceServer(server, s)
+	keto.RegisterReadServiceServer(server, s)
+	keto.RegisterWriteServiceServer(server, s)
+}
+
+// matches reports whether the tuple matches the query.
+func (s *testKetoTupleServer) matches(query *keto.RelationQuery, tuple *keto.RelationTuple) bool {
+	return (query.Namespace == nil || query.GetNamespace() == tuple.GetNamespace()) &&
+		(query.Object == nil || query.GetObject() == tuple.GetObject()) &&
+		(query.Relation == nil || query.GetRelation() == tuple.GetRelation()) &&
+		(query.Subject == nil || formatSubject(query.GetSubject()) == formatSubject(tuple.GetSubject()))
+}
+
+// Check allows the check if the tuple is stored.
+func (s *testKetoTupleServer) Check(_ context.Context, req *keto.CheckRequest) (*keto.CheckResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	query := &keto.RelationQuery{
+		Namespace: &req.Namespace,
+		Object:    &req.Object,
+		Relation:  &req.Relation,
+		Subject:   req.GetSubject(),
+	}
+
+	for _, tuple := range s.tuples {
+		if s.matches(query, tuple) {
+			return &keto.CheckResponse{Allowed: true}, nil
+		}
+	}
+
+	return &keto.CheckResponse{}, nil
+}
+
+// ListRelationTuples returns the stored tuples matching the query, in a single page.
+func (s *testKetoTupleServer) ListRelationTuples(
+	_ context.Context,
+	req *keto.ListRelationTuplesRequest,
+) (*keto.ListRelationTuplesResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	res := &keto.ListRelationTuplesResponse{}
+	for _, tuple := range s.tuples {
+		if s.matches(req.GetRelationQuery(), tuple) {
+			res.RelationTuples = append(res.RelationTuples, tuple)
+		}
+	}
+
+	return res, nil
+}
+
+// TransactRelationTuples inserts and deletes the tuples of the deltas.
+func (s *testKetoTupleServer) TransactRelationTuples(
+	_ context.Context,
+	req *keto.TransactRelationTuplesRequest,
+) (*keto.TransactRelationTuplesResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, delta := range req.GetRelationTupleDeltas() {
+		if delta.GetAction() == keto.RelationTupleDelta_ACTION_INSERT {
+			s.tuples = append(s.tuples, delta.GetRelationTuple())
+		}
+	}
+
+	return &keto.TransactRelationTuplesResponse{Snaptokens: []string{"snaptoken"}}, nil
+}
+
+// DeleteRelationTuples deletes the stored tuples matching the query.
+func (s *testKetoTupleServer) DeleteRelationTuples(
+	_ context.Context,
+	req *keto.DeleteRelationTuplesRequest,
+) (*keto.DeleteRelationTuplesResponse, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var kept []*keto.RelationTuple
+	for _, tuple := range s.tuples {
+		if !s.matches(req.GetRelationQuery(), tuple) {
+			kept = append(kept, tuple)
+		}
+	}
+
+	s.tuples = kept
+
+	return &keto.DeleteRelationTuplesResponse{}, nil
+}
+
+// newTestTupleBackend returns a backend configured to log in and manage tuples against an in-process Kratos and Keto.
+func newTestTupleBackend(t *testing.T) (*OryAuthBackend, logical.Storage, *testKetoTupleServer) {
+	t.Helper()
+
+	b, s := newTestBackend(t)
+
+	tupleServer := &testKetoTupleServer{}
+	startTestKetoServices(t, b, tupleServer.register)
+
+	kratosURL := startTestKratos(t, "alice")
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"kratos_public_url": kratosURL,
+		"kratos_admin_url":  kratosURL,
+	})
+
+	return b, s, tupleServer
+}
+
+// ketoTuplesRequest makes a request to the Keto tuples path.
+func ketoTuplesRequest(
+	t *testing.T,
+	b *OryAuthBackend,
+	s logical.Storage,
+	operation logical.Operation,
+	data map[string]interface{},
+) *logical.Response {
+	t.Helper()
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: operation,
+		Path:      "keto/tuples",
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("%s keto/tuples: %v", operation, err)
+	}
+
+	return res
+}
+
+func TestKetoTuplesWriteListAndDelete(t *testing.T) {
+	b, s, _ := newTestTupleBackend(t)
+
+	res := ketoTuplesRequest(t, b, s, logical.UpdateOperation, map[string]interface{}{
+		"tuple": "files:reports#view@alice",
+	})
+	if res == nil || res.IsError() {
+		t.Fatalf("writing tuple: %v", res)
+	}
+
+	if got := res.Data["snaptoken"]; got != "snaptoken" {
+		t.Errorf("snaptoken = %v, want snaptoken", got)
+	}
+
+	res = ketoTuplesRequest(t, b, s, logical.UpdateOperation, map[string]interface{}{
+		"namespace": "files",
+		"object":    "budgets",
+		"relation":  "view",
+		"subject":   "groups:finance#member",
+	})
+	if res == nil || res.IsError() {
+		t.Fatalf("writing tuple: %v", res)
+	}
+
+	res = ketoTuplesRequest(t, b, s, logical.ListOperation, map[string]interface{}{
+		"object": "reports",
+	})
+	if res == nil || res.IsError() {
+		t.Fatalf("listing tuples: %v", res)
+	}
+
+	keys, _ := res.Data["keys"].([]string)
+	if len(keys) != 1 || keys[0] != "files:reports#view@alice" {
+		t.Errorf("keys = %v, want [files:reports#view@alice]", keys)
+	}
+
+	info := res.Data["key_info"].(map[string]interface{})["files:reports#view@alice"].(map[string]interface{})
+	if info["subject"] != "alice" || info["relation"] != "view" {
+		t.Errorf("unexpected key info %v", info)
+	}
+
+	res = ketoTuplesRequest(t, b, s, logical.DeleteOperation, map[string]interface{}{
+		"object": "reports",
+	})
+	if res == nil || !res.IsError() {
+		t.Errorf("delete without a namespace was accepted: %v", res)
+	}
+
+	res = ketoTuplesRequest(t, b, s, logical.DeleteOperation, map[string]interface{}{
+		"namespace": "files",
+		"object":    "reports",
+	})
+	if res == nil || res.IsError() {
+		t.Fatalf("deleting tuples: %v", res)
+	}
+
+	res = ketoTuplesRequest(t, b, s, logical.ListOperation, map[string]interface{}{
+		"namespace": "files",
+	})
+
+	keys, _ = res.Data["keys"].([]string)
+	if len(keys) != 1 || keys[0] != "files:budgets#view@groups:finance#member" {
+		t.Errorf("keys after delete = %v, want [files:budgets#view@groups:finance#member]", keys)
+	}
+}
+
+func TestKetoTuplesRejectInvalidTuples(t *testing.T) {
+	b, s, _ := newTestTupleBackend(t)
+
+	for _, data := range []map[string]interface{}{
+		{"tuple": "files:reports#view"},
+		{"tuple": "reports#view@alice"},
+		{"namespace": "files", "object": "reports", "subject": "alice"},
+		{"namespace": "files", "object": "reports", "relation": "view"},
+	} {
+		res := ketoTuplesRequest(t, b, s, logical.UpdateOperation, data)
+		if res == nil || !res.IsError() {
+			t.Errorf("invalid tuple %v accepted: %v", data, res)
+		}
+	}
+}
+
+func TestKetoTupleWriteAndDeleteTakeEffectOnLogin(t *testing.T) {
+	b, s, _ := newTestTupleBackend(t)
+
+	res, _ := testLogin(b, s, "reports")
+	if res == nil || res.Auth != nil {
+		t.Fatalf("login allowed before the tuple was written: %v", res)
+	}
+
+	ketoTuplesRequest(t, b, s, logical.UpdateOperation, map[string]interface{}{
+		"tuple": "files:reports#view@alice",
+	})
+
+	res, err := testLogin(b, s, "reports")
+	if err != nil {
+		t.Fatalf("logging in: %v", err)
+	}
+
+	if res == nil || res.Auth == nil {
+		t.Fatalf("login denied after the tuple was written: %v", res)
+	}
+
+	ketoTuplesRequest(t, b, s, logical.DeleteOperation, map[string]interface{}{
+		"tuple": "files:reports#view@alice",
+	})
+
+	res, _ = testLogin(b, s, "reports")
+	if res == nil || res.Auth != nil {
+		t.Errorf("login allowed after the tuple was deleted: %v", res)
+	}
+}
@@ -3,6 +3,7 @@ package plugin
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,6 +14,9 @@ import (
 	kratos "github.com/ory/kratos-client-go"
 
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
@@ -23,40 +27,73 @@ Authenticates Ory Kratos users with Vault and authorises a policy with Keto.
 
 	// pathLoginDesc is used to generate the help text for the login path.
 	pathLoginDescription = `
-Authenticate Ory Kratos identities using a Kratos session cookie.
+Authenticate Ory Kratos identities using a Kratos session cookie, or
+machine clients using an Ory Hydra OAuth2 access token.
 Authorise the identity with Keto using a namespace, object and relation.
 Resulting policy is named after the namespace and relation in the format
 namespace_relation.
 `
 )
 
+// loginFields are the fields accepted by the login endpoint.
+var loginFields map[string]*framework.FieldSchema = map[string]*framework.FieldSchema{
+	"kratos_session_cookie": {
+		Type: framework.TypeString,
+		Description: `The Kratos session cookie.
+This is the value of the Kratos session cookie.`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"identity_grant": {
+		Type: framework.TypeString,
+		Description: `A single-use identity grant issued at identity/grant.
+Used instead of 'kratos_session_cookie' by trusted services logging in on behalf of an identity.`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"oauth2_access_token": {
+		Type: framework.TypeString,
+		Description: `An OAuth2 access token issued by Ory Hydra, introspected with the Hydra admin API.
+Used instead of 'kratos_session_cookie' by machine clients. Requires 'hydra_admin_url' to be configured.`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+	"namespace": {
+		Type: framework.TypeString,
+		Description: `Keto namespace of the resource being authenticated against.
+If 'namespace' is not specified, login fails.`,
+	},
+	"object": {
+		Type: framework.TypeString,
+		Description: `Keto object being authenticated against.
+If 'object' is not specified, login fails.`,
+	},
+	"relation": {
+		Type: framework.TypeString,
+		Description: `Keto relation between subject and object being authenticated against.
+If 'relation' is not specified, login fails.`,
+	},
+	"keto_latest": {
+		Type: framework.TypeBool,
+		Description: `If true, Keto checks the relation on its latest snapshot.
+The check cache is bypassed.`,
+	},
+	"keto_snaptoken": {
+		Type: framework.TypeString,
+		Description: `Keto snaptoken, as returned when relation tuples were written; the relation is checked on a snapshot at least as fresh.
+The check cache is bypassed.`,
+	},
+}
+
 // NewPathLogin returns the path for the login endpoint.
 func NewPathLogin(b *OryAuthBackend) []*framework.Path {
 	return []*framework.Path{
 		{
 			Pattern: "login$",
-			Fields: map[string]*framework.FieldSchema{
-				"kratos_session_cookie": {
-					Type: framework.TypeString,
-					Description: `The Kratos session cookie.
-This is the value of the Kratos session cookie.`,
-				},
-				"namespace": {
-					Type: framework.TypeString,
-					Description: `Keto namespace of the resource being authenticated against.
-If 'namespace' is not specified, login fails.`,
-				},
-				"object": {
-					Type: framework.TypeString,
-					Description: `Keto object being authenticated against.
-If 'object' is not specified, login fails.`,
-				},
-				"relation": {
-					Type: framework.TypeString,
-					Description: `Keto relation between subject and object being authenticated against.
-If 'relation' is not specified, login fails.`,
-				},
-			},
+			Fields:  loginFields,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.UpdateOperation: b.loginUpdateHandler,
 			},
@@ -67,6 +104,7 @@ If 'relation' is not specified, login fails.`,
 }
 
 // loginUpdateHandler is the handler for the login path.
+// Failed logins are returned with the HTTP status and 'error_code' of their login error.
 func (b *OryAuthBackend) loginUpdateHandler(
 	ctx context.Context,
 	req *logical.Request,
@@ -74,80 +112,265 @@ func (b *OryAuthBackend) loginUpdateHandler(
 ) (*logical.Response, error) {
 	b.Logger().Debug("pathLoginUpdate called")
 
-	kratosSession, err := b.getKratosSession(ctx, req, data)
+	start := time.Now()
+	method := getLoginMethod(data)
+
+	ctx, span := b.startLoginSpan(ctx, req, method)
+	auth, err := b.login(ctx, req, data)
+	endSpan(span, err)
+
+	recordLogin(req, method, data.Get("namespace").(string), data.Get("relation").(string), start, err)
+	if err != nil {
+		return loginErrorResponse(req, err)
+	}
+
+	res := &logical.Response{
+		Auth: auth,
+	}
+
+	return res, nil
+}
+
+// login authenticates the credential in the request and authorises it with Keto.
+// Logins over the rate limits are rejected before Kratos, Hydra or Keto are called.
+// Every login decision is recorded in the login audit trail, including malformed and rejected logins.
+func (b *OryAuthBackend) login(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (auth *logical.Auth, err error) {
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var namespace, object, relation string
+	var principal *loginPrincipal
+	defer func() {
+		b.auditLogin(ctx, req, config, getLoginMethod(data), namespace, object, relation, principal, err)
+	}()
+
+	namespace, err = b.getNamespace(data)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err = b.getObject(data)
+	if err != nil {
+		return nil, err
+	}
+
+	relation, err = b.getRelation(data)
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		return nil, err
 	}
 
-	namespace, err := b.getNamespace(data)
+	err = checkBoundCIDRs(config, clientIP(req))
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		return nil, err
 	}
 
-	object, err := b.getObject(data)
+	err = b.checkLoginRateLimit(config, req, getLoginCredential(data))
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		return nil, err
 	}
 
-	relation, err := b.getRelation(data)
+	principal, err = b.getLoginPrincipal(ctx, req, data, namespace, object, relation)
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		return nil, err
 	}
 
-	subject, err := b.getSubject(kratosSession)
+	err = b.checkIdentityRateLimit(config, principal)
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		return nil, err
+	}
+
+	auth, err = b.authorizeLogin(ctx, req, config, principal, namespace, object, relation, getKetoConsistency(data))
+
+	return auth, err
+}
+
+// getLoginCredential returns the credential in the request, whichever login method it is for.
+func getLoginCredential(data *framework.FieldData) string {
+	for _, field := range []string{"identity_grant", "oauth2_access_token", "kratos_session_cookie"} {
+		if val, ok := data.GetOk(field); ok {
+			return val.(string)
+		}
+	}
+
+	return ""
+}
+
+// getLoginMethod returns the login method label of the credential in the request.
+func getLoginMethod(data *framework.FieldData) string {
+	if _, ok := data.GetOk("identity_grant"); ok {
+		return loginMethodIdentityGrant
+	}
+
+	if _, ok := data.GetOk("oauth2_access_token"); ok {
+		return loginMethodOAuth2
+	}
+
+	return loginMethodKratosSession
+}
+
+// loginPrincipal is the Ory identity a login is authorised for.
+type loginPrincipal struct {
+	// Subject is the Keto subject ID checked for the relation.
+	Subject string
+
+	// SessionID is the ID of the Kratos session used to log in, if any.
+	SessionID string
+
+	// ExpiresAt is when the credential used to log in expires, if it does.
+	ExpiresAt *time.Time
+
+	// Metadata is added to the alias metadata of the issued token.
+	Metadata map[string]string
+}
+
+// getLoginPrincipal authenticates the credential in the request and returns its principal.
+func (b *OryAuthBackend) getLoginPrincipal(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+	namespace string,
+	object string,
+	relation string,
+) (*loginPrincipal, error) {
+	if val, ok := data.GetOk("identity_grant"); ok {
+		return b.identityGrantPrincipal(ctx, req, val.(string), namespace, object, relation)
+	}
+
+	if val, ok := data.GetOk("oauth2_access_token"); ok {
+		return b.oauth2Principal(ctx, req, val.(string))
+	}
+
+	kratosSession, err := b.getKratosSession(ctx, req, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.sessionPrincipal(kratosSession)
+}
+
+// sessionPrincipal returns the principal for a Kratos session.
+func (b *OryAuthBackend) sessionPrincipal(session *kratos.Session) (*loginPrincipal, error) {
+	subject, err := b.getSubject(session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &loginPrincipal{
+		Subject:   subject,
+		SessionID: session.GetId(),
+		ExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// authorizeLogin checks the principal's relation to the object in the namespace with Keto
+// and returns the auth that a successful login issues.
+// Denied identities and sessions are rejected before Keto is checked.
+func (b *OryAuthBackend) authorizeLogin(
+	ctx context.Context,
+	req *logical.Request,
+	config *Config,
+	principal *loginPrincipal,
+	namespace string,
+	object string,
+	relation string,
+	consistency *ketoConsistency,
+) (*logical.Auth, error) {
+	err := b.checkDenied(ctx, req.Storage, principal)
+	if err != nil {
+		return nil, err
 	}
 
 	// TODO (TW) do we replace with List call and create policies for all relations?
-	allowed, err := b.checkRelation(ctx, req, namespace, object, relation, subject)
+	allowed, err := b.checkRelation(ctx, req, namespace, object, relation, principal.Subject, consistency)
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		return nil, err
 	}
 
 	if !allowed {
-		return logical.ErrorResponse(
-			"subject does not have the relation to the object in the namespace",
-		), nil
+		return nil, permissionDeniedError(errors.New("subject does not have the relation to the object in the namespace"))
 	}
 
+	ctx, span := startSpan(ctx, "ory.policy.resolve")
+	defer span.End()
+
+	auth := buildLoginAuth(getTokenConfig(config), principal, namespace, object, relation)
+	span.SetAttributes(attribute.StringSlice("vault.policies", auth.Policies))
+
+	err = setTokenBoundCIDRs(config, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth, nil
+}
+
+// buildLoginAuth returns the renewable auth issued to the principal for the relation to the object in the namespace.
+// Its lifetimes are capped by the expiry of the credential, which is kept so renewals can be refused after it.
+func buildLoginAuth(
+	config *TokenConfig,
+	principal *loginPrincipal,
+	namespace string,
+	object string,
+	relation string,
+) *logical.Auth {
 	policy := strings.Join([]string{namespace, relation}, "_")
 	policies := []string{policy}
 
-	metadata := map[string]string{
-		"namespace": namespace,
-		"object":    object,
-		"relation":  relation,
-		"subject":   subject,
+	metadata := map[string]string{}
+	for key, value := range principal.Metadata {
+		metadata[key] = value
 	}
 
+	metadata["namespace"] = namespace
+	metadata["object"] = object
+	metadata["relation"] = relation
+	metadata["subject"] = principal.Subject
+
 	internalData := map[string]interface{}{
-		"namespace": namespace,
-		"object":    object,
-		"relation":  relation,
-		"subject":   subject,
+		"namespace":  namespace,
+		"object":     object,
+		"relation":   relation,
+		"subject":    principal.Subject,
+		"session_id": principal.SessionID,
 	}
 
-	res := &logical.Response{
-		Auth: &logical.Auth{
-			Period: 1 * time.Hour,
-			Alias: &logical.Alias{
-				// Name:     "kratos-session-" + kratosSession.Id,
-				Name:     "ory-auth",
-				Metadata: metadata,
-			},
-			Policies:     policies,
-			InternalData: internalData,
-			DisplayName:  "kratos-keto",
-			LeaseOptions: logical.LeaseOptions{
-				Renewable: false,
-				TTL:       time.Until(*kratosSession.ExpiresAt),
-				MaxTTL:    1 * time.Hour, // TODO (TW) Map to config
-			},
-		},
+	ttl := config.TTL
+	maxTTL := config.MaxTTL
+	period := config.Period
+
+	if principal.ExpiresAt != nil {
+		internalData["expires_at"] = principal.ExpiresAt.UTC().Format(time.RFC3339Nano)
+
+		untilExpiry := time.Until(*principal.ExpiresAt)
+		ttl = capTTL(ttl, untilExpiry)
+		maxTTL = capTTL(maxTTL, untilExpiry)
+		if period > 0 {
+			period = capTTL(period, untilExpiry)
+		}
 	}
 
-	return res, nil
+	return &logical.Auth{
+		Period: period,
+		Alias: &logical.Alias{
+			// Name:     "kratos-session-" + kratosSession.Id,
+			Name:     "ory-auth",
+			Metadata: metadata,
+		},
+		Policies:     policies,
+		InternalData: internalData,
+		DisplayName:  "kratos-keto",
+		LeaseOptions: logical.LeaseOptions{
+			Renewable: true,
+			TTL:       ttl,
+			MaxTTL:    maxTTL,
+		},
+	}
 }
 
 // getKratosSession returns the Kratos session from the request.
@@ -155,31 +378,67 @@ func (b *OryAuthBackend) getKratosSession(
 	ctx context.Context,
 	req *logical.Request,
 	data *framework.FieldData,
-) (*kratos.Session, error) {
+) (session *kratos.Session, err error) {
+	ctx, span := startSpan(ctx, "ory.kratos.session.validate")
+	defer func() {
+		endSpan(span, err)
+	}()
+
 	val, ok := data.GetOk("kratos_session_cookie")
 	if !ok {
-		return nil, errors.New("kratos_session_cookie is required")
+		return nil, invalidRequestError(errors.New("kratos_session_cookie is required"))
 	}
 
 	kratosSessionCookie, ok := val.(string)
 	if !ok || kratosSessionCookie == "" {
-		return nil, errors.New("missing kratos_session_cookie")
+		return nil, invalidRequestError(errors.New("missing kratos_session_cookie"))
+	}
+	b.Logger().Debug("found kratos session cookie")
+
+	sessionCache, err := b.getSessionCache(ctx, req.Storage)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get session cache")
+	}
+
+	if session := sessionCache.get(kratosSessionCookie); session != nil {
+		b.Logger().Debug("found cached kratos session", "session_id", session.GetId())
+		span.SetAttributes(attribute.Bool("ory.cache.hit", true))
+
+		return session, nil
 	}
-	b.Logger().Debug("found kratos session cookie", "kratos_session_cookie", kratosSessionCookie)
 
 	client, err := b.getKratosClient(ctx, req.Storage)
 	if err != nil {
-		return nil, errors.New("could not get Kratos client")
+		return nil, errors.Wrap(err, "could not get Kratos client")
 	}
-	b.Logger().Debug("got kratos client", "client", client)
+	b.Logger().Debug("got kratos client")
+
+	key := sessionCacheKey(kratosSessionCookie)
+	val, err = b.coalesce(ctx, coalesceCallKratosSession, key, client.policy, func(ctx context.Context) (interface{}, error) {
+		session, _, err := b.validateSessionCookie(ctx, client, kratosSessionCookie)
 
-	session, _, err := b.validateSessionCookie(ctx, client, kratosSessionCookie)
+		return session, err
+	})
 	if err != nil {
 		b.Logger().Error("error while trying to validate kratos session cookie", "err", err)
-		return nil, errors.New("could not validate kratos session cookie")
+
+		switch loginErrorCode(err) {
+		case loginErrorUnauthenticated:
+			return nil, unauthenticatedError(errors.New("invalid or expired kratos session cookie"))
+		case loginErrorUpstreamUnavailable:
+			return nil, upstreamUnavailableError(errors.New("could not validate kratos session cookie: kratos is unavailable"))
+		}
+
+		return nil, errors.Wrap(err, "could not validate kratos session cookie")
 	}
 
-	b.Logger().Debug("found kratos session", "session", session)
+	session = val.(*kratos.Session)
+
+	b.Logger().Debug("found kratos session", "session_id", session.GetId())
+
+	if session.GetActive() {
+		sessionCache.add(kratosSessionCookie, session)
+	}
 
 	return session, nil
 }
@@ -192,12 +451,12 @@ func (b *OryAuthBackend) getNamespace(
 
 	val, ok := data.GetOk("namespace")
 	if !ok {
-		return "", errors.New("namespace is required")
+		return "", invalidRequestError(errors.New("namespace is required"))
 	}
 
 	namespace, ok := val.(string)
 	if !ok || namespace == "" {
-		return "", errors.New("missing namespace")
+		return "", invalidRequestError(errors.New("missing namespace"))
 	}
 
 	return namespace, nil
@@ -211,12 +470,12 @@ func (b *OryAuthBackend) getObject(
 
 	val, ok := data.GetOk("object")
 	if !ok {
-		return "", errors.New("object is required")
+		return "", invalidRequestError(errors.New("object is required"))
 	}
 
 	object, ok := val.(string)
 	if !ok || object == "" {
-		return "", errors.New("missing object")
+		return "", invalidRequestError(errors.New("missing object"))
 	}
 
 	return object, nil
@@ -230,17 +489,41 @@ func (b *OryAuthBackend) getRelation(
 
 	val, ok := data.GetOk("relation")
 	if !ok {
-		return "", errors.New("relation is required")
+		return "", invalidRequestError(errors.New("relation is required"))
 	}
 
 	relation, ok := val.(string)
 	if !ok || relation == "" {
-		return "", errors.New("missing relation")
+		return "", invalidRequestError(errors.New("missing relation"))
 	}
 
 	return relation, nil
 }
 
+// getKetoConsistency returns the consistency requested for the Keto check.
+func getKetoConsistency(data *framework.FieldData) *ketoConsistency {
+	return &ketoConsistency{
+		Latest:    data.Get("keto_latest").(bool),
+		Snaptoken: data.Get("keto_snaptoken").(string),
+	}
+}
+
+// ketoCheckError classifies an error of a Keto check as a login error.
+func ketoCheckError(err error) error {
+	err = errors.Wrap(err, "failed to check relation with keto")
+
+	if errors.Is(err, errCircuitOpen) || isRetryable(err) {
+		return upstreamUnavailableError(err)
+	}
+
+	switch status.Code(errors.Cause(err)) {
+	case codes.InvalidArgument, codes.NotFound:
+		return invalidRequestError(err)
+	}
+
+	return err
+}
+
 // getSubject returns the subject from the Kratos session.
 func (b *OryAuthBackend) getSubject(session *kratos.Session) (string, error) {
 	b.Logger().Debug("getting subject from Kratos session")
@@ -253,6 +536,7 @@ func (b *OryAuthBackend) getSubject(session *kratos.Session) (string, error) {
 }
 
 // checkRelation checks if the subject has the relation to the object in the namespace.
+// Results are served from and added to the check cache unless the consistency requires a fresh check.
 func (b *OryAuthBackend) checkRelation(
 	ctx context.Context,
 	req *logical.Request,
@@ -260,23 +544,49 @@ func (b *OryAuthBackend) checkRelation(
 	object string,
 	relation string,
 	subject string,
-) (bool, error) {
+	consistency *ketoConsistency,
+) (allowed bool, err error) {
 	b.Logger().Debug("checking if subject has relation to object in namespace")
 
+	ctx, span := startSpan(ctx, "ory.keto.check",
+		attribute.String("ory.keto.namespace", namespace),
+		attribute.String("ory.keto.object", object),
+		attribute.String("ory.keto.relation", relation),
+	)
+	defer func() {
+		span.SetAttributes(attribute.Bool("ory.keto.allowed", allowed))
+		endSpan(span, err)
+	}()
+
 	if namespace == "" {
-		return false, errors.New("namespace is empty")
+		return false, invalidRequestError(errors.New("namespace is empty"))
 	}
 
 	if object == "" {
-		return false, errors.New("object is empty")
+		return false, invalidRequestError(errors.New("object is empty"))
 	}
 
 	if relation == "" {
-		return false, errors.New("relation is empty")
+		return false, invalidRequestError(errors.New("relation is empty"))
 	}
 
 	if subject == "" {
-		return false, errors.New("subject is empty")
+		return false, unauthenticatedError(errors.New("subject is empty"))
+	}
+
+	checkCache, err := b.getCheckCache(ctx, req.Storage)
+	if err != nil {
+		return false, err
+	}
+
+	cacheable := checkCache.cacheable(namespace, consistency)
+	if cacheable {
+		if allowed, ok := checkCache.get(namespace, object, relation, subject); ok {
+			b.Logger().Debug("found cached relation check", "allowed", allowed)
+			span.SetAttributes(attribute.Bool("ory.cache.hit", true))
+
+			return allowed, nil
+		}
 	}
 
 	b.Logger().Debug("getting keto client")
@@ -284,42 +594,81 @@ func (b *OryAuthBackend) checkRelation(
 	if err != nil {
 		return false, err
 	}
+	defer ketoClient.release()
 	b.Logger().Debug("got keto client")
 
+	checkRequest := newCheckRequest(&keto.RelationTuple{
+		Namespace: namespace,
+		Object:    object,
+		Relation:  relation,
+		Subject:   keto.NewSubjectID(subject),
+	}, 0, consistency)
+
+	key := checkCacheKey(namespace, object, relation, subject)
+	if consistency != nil {
+		key = strings.Join([]string{key, strconv.FormatBool(consistency.Latest), consistency.Snaptoken}, "\x00")
+	}
+
 	b.Logger().Debug("checking relation")
-	res, err := ketoClient.CheckServiceClient.Check(
-		ctx,
-		&keto.CheckRequest{
-			Namespace: namespace,
-			Object:    object,
-			Relation:  relation,
-			Subject:   keto.NewSubjectID(subject),
-		},
-	)
+	val, err := b.coalesce(ctx, coalesceCallKetoCheck, key, ketoClient.policy, func(ctx context.Context) (interface{}, error) {
+		var res *keto.CheckResponse
+		err := ketoClient.policy.do(ctx, func(ctx context.Context) error {
+			var err error
+			res, err = ketoClient.CheckServiceClient.Check(ctx, checkRequest)
+
+			return err
+		})
+		if err != nil {
+			return false, ketoCheckError(err)
+		}
+
+		return res.GetAllowed(), nil
+	})
 	if err != nil {
 		return false, err
 	}
 
-	return res.GetAllowed(), nil
+	allowed = val.(bool)
+
+	if cacheable {
+		checkCache.add(namespace, object, relation, subject, allowed)
+	}
+
+	return allowed, nil
 }
 
 // validateSessionCookie validates the session cookie by making a request to the Kratos API.
+// Failed requests are retried according to the client's call policy.
 func (b *OryAuthBackend) validateSessionCookie(
 	ctx context.Context,
-	client *kratos.APIClient,
+	client *KratosClient,
 	kratosSessionCookie string,
 ) (*kratos.Session, int, error) {
-	session, res, err := client.V0alpha2Api.ToSessionExecute(
-		kratos.V0alpha2ApiApiToSessionRequest{}.Cookie(kratosSessionCookie),
-	)
+	var session *kratos.Session
+	var res *http.Response
+	err := client.policy.do(ctx, func(ctx context.Context) error {
+		var err error
+		session, res, err = client.PublicClient.V0alpha2Api.ToSession(ctx).Cookie(kratosSessionCookie).Execute()
+
+		return kratosCallError(res, err)
+	})
 	if err != nil {
 		b.Logger().Error("error while trying to get kratos session", "err", err)
-		return nil, http.StatusInternalServerError, errors.Wrap(err, "failed to get kratos session")
+
+		if res == nil || res.StatusCode >= http.StatusInternalServerError {
+			return nil, http.StatusServiceUnavailable, upstreamUnavailableError(errors.Wrap(err, "failed to get kratos session"))
+		}
+
+		if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden {
+			return nil, res.StatusCode, unauthenticatedError(errors.Wrap(err, "failed to get kratos session"))
+		}
+
+		return nil, res.StatusCode, errors.Wrap(err, "failed to get kratos session")
 	}
 
 	if res.StatusCode != http.StatusOK {
 		b.Logger().Debug("status was not 200", "status", res.StatusCode)
-		return nil, res.StatusCode, errors.Wrap(err, "failed to get kratos session")
+		return nil, res.StatusCode, unauthenticatedError(errors.Errorf("failed to get kratos session: %v", res.StatusCode))
 	}
 
 	return session, http.StatusOK, nil
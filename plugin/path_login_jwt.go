@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// pathLoginJWTSynopsis is used to generate the help text for the JWT login path.
+	pathLoginJWTSynopsis = `
+Authenticates with a signed JWT and authorises a policy with Keto.
+`
+
+	// pathLoginJWTDescription is used to generate the help text for the JWT login path.
+	pathLoginJWTDescription = `
+Authenticate using a JWT issued by Ory Oathkeeper's id_token mutator or the
+Kratos session tokenizer. The JWT is verified locally against the configured
+JWKS URL or public keys, without a call to Kratos, and its subject claim is
+authorised with Keto using a namespace, object and relation.
+Resulting policy is named after the namespace and relation in the format
+namespace_relation.
+`
+)
+
+// NewPathLoginJWT returns the path for the JWT login endpoint.
+func NewPathLoginJWT(b *OryAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "login/jwt$",
+			Fields: map[string]*framework.FieldSchema{
+				"jwt": {
+					Type:        framework.TypeString,
+					Description: "The signed JWT.",
+					DisplayAttrs: &framework.DisplayAttributes{
+						Sensitive: true,
+					},
+				},
+				"namespace":      loginFields["namespace"],
+				"object":         loginFields["object"],
+				"relation":       loginFields["relation"],
+				"keto_latest":    loginFields["keto_latest"],
+				"keto_snaptoken": loginFields["keto_snaptoken"],
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.loginJWTHandler,
+			},
+			HelpSynopsis:    pathLoginJWTSynopsis,
+			HelpDescription: pathLoginJWTDescription,
+		},
+	}
+}
+
+// loginJWTHandler is the handler for the JWT login path.
+// Failed logins are returned with the HTTP status and 'error_code' of their login error.
+func (b *OryAuthBackend) loginJWTHandler(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	b.Logger().Debug("loginJWTHandler called")
+
+	start := time.Now()
+
+	ctx, span := b.startLoginSpan(ctx, req, loginMethodJWT)
+	auth, err := b.loginJWT(ctx, req, data)
+	endSpan(span, err)
+
+	recordLogin(req, loginMethodJWT, data.Get("namespace").(string), data.Get("relation").(string), start, err)
+	if err != nil {
+		return loginErrorResponse(req, err)
+	}
+
+	res := &logical.Response{
+		Auth: auth,
+	}
+
+	return res, nil
+}
+
+// loginJWT verifies the JWT in the request and authorises its subject with Keto.
+// Logins over the rate limits are rejected before the JWKS or Keto are called.
+// Every login decision is recorded in the login audit trail, including malformed and rejected logins.
+func (b *OryAuthBackend) loginJWT(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (auth *logical.Auth, err error) {
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var namespace, object, relation string
+	var principal *loginPrincipal
+	defer func() {
+		b.auditLogin(ctx, req, config, loginMethodJWT, namespace, object, relation, principal, err)
+	}()
+
+	namespace, err = b.getNamespace(data)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err = b.getObject(data)
+	if err != nil {
+		return nil, err
+	}
+
+	relation, err = b.getRelation(data)
+	if err != nil {
+		return nil, err
+	}
+
+	token := data.Get("jwt").(string)
+
+	err = checkBoundCIDRs(config, clientIP(req))
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.checkLoginRateLimit(config, req, token)
+	if err != nil {
+		return nil, err
+	}
+
+	principal, err = b.jwtPrincipal(ctx, req, token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.checkIdentityRateLimit(config, principal)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err = b.authorizeLogin(ctx, req, config, principal, namespace, object, relation, getKetoConsistency(data))
+
+	return auth, err
+}
@@ -0,0 +1,197 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// pathLoginPreviewSynopsis is used to generate the help text for the login preview path.
+	pathLoginPreviewSynopsis = `
+Previews the result of a login without issuing a token.
+`
+
+	// pathLoginPreviewDescription is used to generate the help text for the login preview path.
+	pathLoginPreviewDescription = `
+Runs the same validation and Keto checks as the login endpoint for a Kratos
+session cookie, an OAuth2 access token, a JWT or a Kratos identity ID, and returns the policies, alias
+name, metadata and TTLs that would be issued. No token is created.
+This endpoint requires a Vault token and is intended for administrators rolling
+out policy changes.
+
+The bound CIDRs are checked against 'remote_addr', the address the login would
+come from, and are skipped if it is not given. Rate limits are never applied to
+previews. The checks that were not run are returned in 'skipped_checks'.
+`
+)
+
+// NewPathLoginPreview returns the path for the login preview endpoint.
+func NewPathLoginPreview(b *OryAuthBackend) []*framework.Path {
+	fields := map[string]*framework.FieldSchema{
+		"identity_id": {
+			Type: framework.TypeString,
+			Description: `Kratos identity ID to preview the login for, instead of a session cookie.
+The identity is looked up with the Kratos admin API.`,
+		},
+		"jwt": {
+			Type:        framework.TypeString,
+			Description: "Signed JWT to preview the login for, as accepted by login/jwt.",
+			DisplayAttrs: &framework.DisplayAttributes{
+				Sensitive: true,
+			},
+		},
+		"remote_addr": {
+			Type:        framework.TypeString,
+			Description: "Client address to check the bound CIDRs against. The bound CIDRs are not checked if empty.",
+		},
+	}
+	for name, field := range loginFields {
+		fields[name] = field
+	}
+
+	// Previews must not consume identity grants.
+	delete(fields, "identity_grant")
+
+	return []*framework.Path{
+		{
+			Pattern: "login/preview$",
+			Fields:  fields,
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.loginPreviewHandler,
+			},
+			HelpSynopsis:    pathLoginPreviewSynopsis,
+			HelpDescription: pathLoginPreviewDescription,
+		},
+	}
+}
+
+// loginPreviewHandler is the handler for the login preview path.
+func (b *OryAuthBackend) loginPreviewHandler(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	b.Logger().Debug("loginPreviewHandler called")
+
+	principal, err := b.getPreviewPrincipal(ctx, req, data)
+	if err != nil {
+		return loginErrorResponse(req, err)
+	}
+
+	namespace, err := b.getNamespace(data)
+	if err != nil {
+		return loginErrorResponse(req, err)
+	}
+
+	object, err := b.getObject(data)
+	if err != nil {
+		return loginErrorResponse(req, err)
+	}
+
+	relation, err := b.getRelation(data)
+	if err != nil {
+		return loginErrorResponse(req, err)
+	}
+
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		return loginErrorResponse(req, err)
+	}
+
+	// Previews are made by an administrator, so the bound CIDRs are checked against the given address instead.
+	skippedChecks := []string{"rate_limits"}
+
+	remoteAddr := data.Get("remote_addr").(string)
+	if remoteAddr == "" {
+		skippedChecks = append(skippedChecks, "bound_cidrs")
+	} else {
+		err = checkBoundCIDRs(config, remoteAddr)
+		if err != nil {
+			return loginPreviewDeniedResponse(principal, skippedChecks, err), nil
+		}
+	}
+
+	auth, err := b.authorizeLogin(ctx, req, config, principal, namespace, object, relation, getKetoConsistency(data))
+	if err != nil {
+		return loginPreviewDeniedResponse(principal, skippedChecks, err), nil
+	}
+
+	boundCIDRs := make([]string, 0, len(auth.BoundCIDRs))
+	for _, cidr := range auth.BoundCIDRs {
+		boundCIDRs = append(boundCIDRs, cidr.String())
+	}
+
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			"allowed":        true,
+			"subject":        principal.Subject,
+			"policies":       auth.Policies,
+			"display_name":   auth.DisplayName,
+			"alias_name":     auth.Alias.Name,
+			"alias_metadata": auth.Alias.Metadata,
+			"ttl":            int64(auth.TTL.Seconds()),
+			"max_ttl":        int64(auth.MaxTTL.Seconds()),
+			"period":         int64(auth.Period.Seconds()),
+			"renewable":      auth.Renewable,
+			"bound_cidrs":    boundCIDRs,
+			"skipped_checks": skippedChecks,
+		},
+	}
+
+	return res, nil
+}
+
+// loginPreviewDeniedResponse returns the preview response of a login denied with the error.
+func loginPreviewDeniedResponse(principal *loginPrincipal, skippedChecks []string, err error) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"allowed":        false,
+			"subject":        principal.Subject,
+			"reason":         err.Error(),
+			"error_code":     loginErrorCode(err),
+			"skipped_checks": skippedChecks,
+		},
+	}
+}
+
+// getPreviewPrincipal returns the principal for the identity ID, JWT, OAuth2 access token or session cookie in the request.
+func (b *OryAuthBackend) getPreviewPrincipal(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*loginPrincipal, error) {
+	if val, ok := data.GetOk("oauth2_access_token"); ok {
+		return b.oauth2Principal(ctx, req, val.(string))
+	}
+
+	if val, ok := data.GetOk("jwt"); ok {
+		return b.jwtPrincipal(ctx, req, val.(string))
+	}
+
+	identityID := data.Get("identity_id").(string)
+	if identityID == "" {
+		if _, ok := data.GetOk("kratos_session_cookie"); !ok {
+			return nil, invalidRequestError(errors.New("kratos_session_cookie, oauth2_access_token, jwt or identity_id is required"))
+		}
+
+		kratosSession, err := b.getKratosSession(ctx, req, data)
+		if err != nil {
+			return nil, err
+		}
+
+		return b.sessionPrincipal(kratosSession)
+	}
+
+	identity, err := b.getKratosIdentity(ctx, req.Storage, identityID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &loginPrincipal{
+		Subject: identity.Id,
+	}, nil
+}
@@ -0,0 +1,132 @@
+package plugin
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// newTestPreviewBackend returns a backend configured to preview logins against an in-process Kratos and Keto.
+func newTestPreviewBackend(t *testing.T, checkServer *testKetoCheckServer) (*OryAuthBackend, logical.Storage) {
+	t.Helper()
+
+	b, s := newTestBackend(t)
+	startTestKeto(t, b, checkServer)
+
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"kratos_public_url": startTestKratos(t, "alice"),
+		"kratos_admin_url":  startTestKratosAdmin(t, "alice", "active"),
+	})
+
+	return b, s
+}
+
+// testLoginPreview previews a login for the relation to the reports object, with the given fields.
+func testLoginPreview(t *testing.T, b *OryAuthBackend, s logical.Storage, fields map[string]interface{}) *logical.Response {
+	t.Helper()
+
+	data := map[string]interface{}{
+		"namespace": "files",
+		"object":    "reports",
+		"relation":  "view",
+	}
+	for key, value := range fields {
+		data[key] = value
+	}
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "login/preview",
+		Storage:    s,
+		Connection: &logical.Connection{RemoteAddr: "192.0.2.1"},
+		Data:       data,
+	})
+	if err != nil {
+		t.Fatalf("previewing login: %v", err)
+	}
+
+	if res == nil {
+		t.Fatal("preview returned no response")
+	}
+
+	return res
+}
+
+func TestLoginPreviewReturnsAuthWithoutToken(t *testing.T) {
+	b, s := newTestPreviewBackend(t, &testKetoCheckServer{})
+
+	for name, fields := range map[string]map[string]interface{}{
+		"identity id":    {"identity_id": "alice"},
+		"session cookie": {"kratos_session_cookie": "ory_kratos_session=test"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			res := testLoginPreview(t, b, s, fields)
+
+			if res.Auth != nil {
+				t.Fatal("preview issued a token")
+			}
+
+			if res.Data["allowed"] != true || res.Data["subject"] != "alice" {
+				t.Fatalf("unexpected preview %v", res.Data)
+			}
+
+			if got := res.Data["policies"]; !reflect.DeepEqual(got, []string{"files_view"}) {
+				t.Errorf("policies = %v, want [files_view]", got)
+			}
+
+			if got := res.Data["alias_metadata"].(map[string]string)["subject"]; got != "alice" {
+				t.Errorf("alias_metadata subject = %v, want alice", got)
+			}
+
+			if got := res.Data["skipped_checks"]; !reflect.DeepEqual(got, []string{"rate_limits", "bound_cidrs"}) {
+				t.Errorf("skipped_checks = %v, want [rate_limits bound_cidrs]", got)
+			}
+		})
+	}
+}
+
+func TestLoginPreviewReportsKetoDenial(t *testing.T) {
+	b, s := newTestPreviewBackend(t, &testKetoCheckServer{deny: true})
+
+	res := testLoginPreview(t, b, s, map[string]interface{}{"identity_id": "alice"})
+
+	if res.Data["allowed"] != false || res.Data["error_code"] != loginErrorPermissionDenied {
+		t.Errorf("expected a denied preview, got %v", res.Data)
+	}
+}
+
+func TestLoginPreviewChecksBoundCIDRsAgainstRemoteAddr(t *testing.T) {
+	b, s := newTestPreviewBackend(t, &testKetoCheckServer{})
+
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"bound_cidrs": "10.0.0.0/8",
+	})
+
+	res := testLoginPreview(t, b, s, map[string]interface{}{
+		"identity_id": "alice",
+		"remote_addr": "192.168.1.1",
+	})
+
+	if res.Data["allowed"] != false || res.Data["error_code"] != loginErrorPermissionDenied {
+		t.Errorf("expected a preview denied by the bound CIDRs, got %v", res.Data)
+	}
+
+	if got := res.Data["skipped_checks"]; !reflect.DeepEqual(got, []string{"rate_limits"}) {
+		t.Errorf("skipped_checks = %v, want [rate_limits]", got)
+	}
+
+	res = testLoginPreview(t, b, s, map[string]interface{}{
+		"identity_id": "alice",
+		"remote_addr": "10.1.2.3",
+	})
+
+	if res.Data["allowed"] != true {
+		t.Fatalf("expected an allowed preview, got %v", res.Data)
+	}
+
+	if got := res.Data["bound_cidrs"]; !reflect.DeepEqual(got, []string{"10.0.0.0/8"}) {
+		t.Errorf("bound_cidrs = %v, want [10.0.0.0/8]", got)
+	}
+}
@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// sessionCacheInvalidateSynopsis is used to provide a short summary of the session cache invalidation path.
+	sessionCacheInvalidateSynopsis = `Removes validated Kratos sessions from the session cache.`
+
+	// sessionCacheInvalidateDescription is used to provide a detailed description of the session cache invalidation path.
+	sessionCacheInvalidateDescription = `
+Removes the cached session with 'session_id', or the cached sessions of
+'identity_id', from the session cache, or every cached session if neither is
+given. The next login with a removed session validates it with Kratos again.
+It is meant to be called by a Kratos web hook or by operators when sessions are
+revoked. The cache is held in memory, so only the node receiving the request
+is invalidated; deny the session to reject it on every node.
+`
+)
+
+// NewPathSessionCache returns the path for invalidating the session cache.
+func NewPathSessionCache(b *OryAuthBackend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "session_cache/invalidate$",
+			Fields: map[string]*framework.FieldSchema{
+				"session_id": {
+					Type:        framework.TypeString,
+					Description: "Kratos session ID to remove from the session cache.",
+				},
+				"identity_id": {
+					Type:        framework.TypeString,
+					Description: "Kratos identity ID whose sessions are removed from the session cache.",
+				},
+			},
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.invalidateSessionCacheHandler,
+			},
+			HelpSynopsis:    sessionCacheInvalidateSynopsis,
+			HelpDescription: sessionCacheInvalidateDescription,
+		},
+	}
+}
+
+// invalidateSessionCacheHandler removes the requested sessions from the session cache.
+func (b *OryAuthBackend) invalidateSessionCacheHandler(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	sessionID := data.Get("session_id").(string)
+	identityID := data.Get("identity_id").(string)
+
+	if sessionID != "" && identityID != "" {
+		return logical.ErrorResponse("only one of session_id and identity_id can be given"), nil
+	}
+
+	sessionCache, err := b.getSessionCache(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := sessionCache.remove(sessionID, identityID)
+
+	b.Logger().Info("invalidated session cache",
+		"session_id", sessionID, "identity_id", identityID, "removed", removed, "invalidated_by", req.DisplayName)
+
+	res := &logical.Response{
+		Data: map[string]interface{}{
+			"removed": removed,
+		},
+	}
+
+	return res, nil
+}
@@ -0,0 +1,202 @@
+package plugin
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// rateLimiterSize is the maximum number of clients, credentials or identities tracked per rate limit.
+	// The least recently seen are forgotten first, and start again with a full burst.
+	rateLimiterSize = 16384
+)
+
+// RateLimiter limits logins with token buckets by client IP, session and identity.
+type RateLimiter struct {
+	// ip limits logins by client IP address, or is nil if disabled.
+	ip *keyedLimiter
+
+	// session limits logins by hash of the session cookie, OAuth2 access token or JWT, or is nil if disabled.
+	session *keyedLimiter
+
+	// identity limits logins by Keto subject, or is nil if disabled.
+	identity *keyedLimiter
+}
+
+// keyedLimiter holds a token bucket per key.
+type keyedLimiter struct {
+	// name names the limit in errors.
+	name string
+
+	// limit is the rate the buckets are refilled at.
+	limit rate.Limit
+
+	// burst is the size of the buckets.
+	burst int
+
+	mutex sync.Mutex
+
+	// limiters holds the *rate.Limiter of each key.
+	limiters *lru.Cache
+}
+
+// getRateLimiter returns the login rate limiter, created from the configuration on first use.
+func (b *OryAuthBackend) getRateLimiter(config *Config) (*RateLimiter, error) {
+	b.rateLimiterMutex.RLock()
+	rateLimiter := b.rateLimiter
+	b.rateLimiterMutex.RUnlock()
+
+	if rateLimiter != nil {
+		return rateLimiter, nil
+	}
+
+	b.rateLimiterMutex.Lock()
+	defer b.rateLimiterMutex.Unlock()
+
+	if b.rateLimiter != nil {
+		return b.rateLimiter, nil
+	}
+
+	rateLimiter, err := newRateLimiter(config)
+	if err != nil {
+		return nil, err
+	}
+
+	b.rateLimiter = rateLimiter
+
+	return b.rateLimiter, nil
+}
+
+// newRateLimiter creates the login rate limiter from the plugin configuration.
+// If all limits are disabled, the limiter allows every login,
+// so it is not created again for every login.
+func newRateLimiter(config *Config) (*RateLimiter, error) {
+	if config == nil || config.RateLimit == nil {
+		return &RateLimiter{}, nil
+	}
+
+	ip, err := newKeyedLimiter("client IP", config.RateLimit.IP, config.RateLimit.IPBurst)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := newKeyedLimiter("session", config.RateLimit.Session, config.RateLimit.SessionBurst)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := newKeyedLimiter("identity", config.RateLimit.Identity, config.RateLimit.IdentityBurst)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RateLimiter{
+		ip:       ip,
+		session:  session,
+		identity: identity,
+	}, nil
+}
+
+// newKeyedLimiter creates a limit of perMinute logins per key, or returns nil if perMinute is zero.
+// A zero burst allows perMinute logins at once.
+func newKeyedLimiter(name string, perMinute int, burst int) (*keyedLimiter, error) {
+	if perMinute <= 0 {
+		return nil, nil
+	}
+
+	if burst <= 0 {
+		burst = perMinute
+	}
+
+	limiters, err := lru.New(rateLimiterSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create rate limiter")
+	}
+
+	return &keyedLimiter{
+		name:     name,
+		limit:    rate.Every(time.Minute / time.Duration(perMinute)),
+		burst:    burst,
+		limiters: limiters,
+	}, nil
+}
+
+// closeRateLimiter drops the login rate limiter, resetting all buckets.
+func (b *OryAuthBackend) closeRateLimiter() {
+	b.rateLimiterMutex.Lock()
+	defer b.rateLimiterMutex.Unlock()
+
+	b.rateLimiter = nil
+}
+
+// allow takes a token from the bucket of the key, and returns a rate limited error if it is empty.
+// Empty keys and disabled limits are not limited.
+func (l *keyedLimiter) allow(key string) error {
+	if l == nil || key == "" {
+		return nil
+	}
+
+	l.mutex.Lock()
+	val, ok := l.limiters.Get(key)
+	if !ok {
+		val = rate.NewLimiter(l.limit, l.burst)
+		l.limiters.Add(key, val)
+	}
+	l.mutex.Unlock()
+
+	if !val.(*rate.Limiter).Allow() {
+		return rateLimitedError(errors.Errorf("too many logins for this %s, retry later", l.name))
+	}
+
+	return nil
+}
+
+// checkLoginRateLimit takes a token from the client IP and session buckets of the login.
+// The session bucket is keyed by a hash of the credential, which may be empty.
+func (b *OryAuthBackend) checkLoginRateLimit(config *Config, req *logical.Request, credential string) error {
+	rateLimiter, err := b.getRateLimiter(config)
+	if err != nil {
+		return errors.Wrap(err, "could not get rate limiter")
+	}
+
+	err = rateLimiter.ip.allow(clientIP(req))
+	if err != nil {
+		return err
+	}
+
+	if credential == "" {
+		return nil
+	}
+
+	return rateLimiter.session.allow(sessionCacheKey(credential))
+}
+
+// checkIdentityRateLimit takes a token from the identity bucket of the login's principal.
+func (b *OryAuthBackend) checkIdentityRateLimit(config *Config, principal *loginPrincipal) error {
+	rateLimiter, err := b.getRateLimiter(config)
+	if err != nil {
+		return errors.Wrap(err, "could not get rate limiter")
+	}
+
+	return rateLimiter.identity.allow(principal.Subject)
+}
+
+// clientIP returns the IP address of the client making the request, or an empty string if it is unknown.
+func clientIP(req *logical.Request) string {
+	if req.Connection == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(req.Connection.RemoteAddr)
+	if err != nil {
+		return req.Connection.RemoteAddr
+	}
+
+	return host
+}
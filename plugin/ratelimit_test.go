@@ -0,0 +1,164 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/hashicorp/vault/sdk/logical"
+	"golang.org/x/time/rate"
+)
+
+// testRateLimitedLogin logs in from the client address with the session cookie.
+func testRateLimitedLogin(
+	t *testing.T,
+	b *OryAuthBackend,
+	s logical.Storage,
+	remoteAddr string,
+	cookie string,
+) *logical.Response {
+	t.Helper()
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "login",
+		Storage:    s,
+		Connection: &logical.Connection{RemoteAddr: remoteAddr},
+		Data: map[string]interface{}{
+			"namespace":             "files",
+			"object":                "reports",
+			"relation":              "view",
+			"kratos_session_cookie": cookie,
+		},
+	})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	return res
+}
+
+func TestLoginRateLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]interface{}
+
+		// remoteAddr and cookie are those of the second login, the first is from 10.0.0.1 with cookie-1.
+		remoteAddr string
+		cookie     string
+
+		// othersAllowed is whether a login from another client with another cookie is still allowed.
+		othersAllowed bool
+	}{
+		{
+			name:       "client IP",
+			config:     map[string]interface{}{"rate_limit_ip": 1, "rate_limit_ip_burst": 1},
+			remoteAddr: "10.0.0.1:1234",
+			cookie:     "cookie-2",
+
+			othersAllowed: true,
+		},
+		{
+			name:       "session",
+			config:     map[string]interface{}{"rate_limit_session": 1, "rate_limit_session_burst": 1},
+			remoteAddr: "10.0.0.2:1234",
+			cookie:     "cookie-1",
+
+			othersAllowed: true,
+		},
+		{
+			name:       "identity",
+			config:     map[string]interface{}{"rate_limit_identity": 1, "rate_limit_identity_burst": 1},
+			remoteAddr: "10.0.0.2:1234",
+			cookie:     "cookie-2",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+			writeTestConfig(t, b, s, test.config)
+
+			res := testRateLimitedLogin(t, b, s, "10.0.0.1:1234", "cookie-1")
+			if res == nil || res.Auth == nil {
+				t.Fatalf("expected the first login to succeed, got %v", res)
+			}
+
+			res = testRateLimitedLogin(t, b, s, test.remoteAddr, test.cookie)
+			assertLoginErrorResponse(t, res, http.StatusTooManyRequests, loginErrorRateLimited)
+
+			res = testRateLimitedLogin(t, b, s, "10.0.0.3:1234", "cookie-3")
+			if allowed := res != nil && res.Auth != nil; allowed != test.othersAllowed {
+				t.Errorf("login from another client and session allowed = %t, want %t", allowed, test.othersAllowed)
+			}
+		})
+	}
+}
+
+func TestRateLimitConfigResetsBuckets(t *testing.T) {
+	b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+	writeTestConfig(t, b, s, map[string]interface{}{"rate_limit_ip": 1, "rate_limit_ip_burst": 1})
+
+	testRateLimitedLogin(t, b, s, "10.0.0.1:1234", "cookie-1")
+	res := testRateLimitedLogin(t, b, s, "10.0.0.1:1234", "cookie-1")
+	assertLoginErrorResponse(t, res, http.StatusTooManyRequests, loginErrorRateLimited)
+
+	writeTestConfig(t, b, s, map[string]interface{}{"rate_limit_ip": 0})
+
+	res = testRateLimitedLogin(t, b, s, "10.0.0.1:1234", "cookie-1")
+	if res == nil || res.Auth == nil {
+		t.Errorf("expected the login to succeed once the limit is disabled, got %v", res)
+	}
+}
+
+func TestKeyedLimiterEvictsLeastRecentlySeen(t *testing.T) {
+	limiters, err := lru.New(2)
+	if err != nil {
+		t.Fatalf("creating cache: %v", err)
+	}
+
+	limiter := &keyedLimiter{name: "test", limit: rate.Every(time.Hour), burst: 1, limiters: limiters}
+
+	if err := limiter.allow("a"); err != nil {
+		t.Fatalf("first allow: %v", err)
+	}
+
+	if err := limiter.allow("a"); err == nil {
+		t.Fatal("expected the empty bucket to be rate limited")
+	}
+
+	if err := limiter.allow("b"); err != nil {
+		t.Fatalf("allow b: %v", err)
+	}
+
+	if err := limiter.allow("c"); err != nil {
+		t.Fatalf("allow c: %v", err)
+	}
+
+	if limiters.Len() != 2 {
+		t.Errorf("tracked keys = %d, want 2", limiters.Len())
+	}
+
+	if err := limiter.allow("a"); err != nil {
+		t.Errorf("expected the evicted key to start with a full bucket, got %v", err)
+	}
+
+	if err := limiter.allow("c"); err == nil {
+		t.Error("expected the recently seen key to stay rate limited")
+	}
+}
+
+func TestKeyedLimiterDisabled(t *testing.T) {
+	limiter, err := newKeyedLimiter("test", 0, 10)
+	if err != nil {
+		t.Fatalf("creating limiter: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := limiter.allow("key"); err != nil {
+			t.Fatalf("expected a disabled limit to allow every login, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package plugin
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	// redacted replaces redacted values in logs.
+	redacted = "[REDACTED]"
+)
+
+var (
+	// sensitiveLogKeys are the log keys whose values are never logged.
+	sensitiveLogKeys = []string{"cookie", "token", "secret", "password", "authorization", "jwt", "apikey", "identity_grant"}
+
+	// sensitiveLogKeySuffixes are the suffixes of log keys whose values are never logged,
+	// such as kratos_session_cookie or oauth2_access_token.
+	// They are matched as suffixes so keys like token_ttl or granted_by are still logged.
+	sensitiveLogKeySuffixes = []string{"_cookie", "_token", "_secret", "_password", "_jwt", "api_key", "client_key"}
+
+	// sensitiveLogValue matches secrets in logged values, such as bearer tokens and Ory API keys.
+	sensitiveLogValue = regexp.MustCompile(`(?i)(bearer\s+|ory_pat_|ory_st_|ory_session_)[^\s"',;]+`)
+
+	// sensitiveHTTPHeader matches the lines of sensitive headers in HTTP dumps.
+	sensitiveHTTPHeader = regexp.MustCompile(`(?im)^(cookie|set-cookie|authorization|x-session-token|ory-session-token):.*$`)
+)
+
+// Logger returns the logger of the backend, which redacts secrets from everything it logs.
+func (b *OryAuthBackend) Logger() hclog.Logger {
+	return &redactingLogger{Logger: b.Backend.Logger()}
+}
+
+// redactingLogger is an hclog.Logger which redacts the values of sensitive keys
+// and secrets found in messages and values.
+type redactingLogger struct {
+	hclog.Logger
+}
+
+// Log redacts and emits the message and key/value pairs at the given level.
+func (l *redactingLogger) Log(level hclog.Level, msg string, args ...interface{}) {
+	l.Logger.Log(level, redactLogValue(msg), redactLogArgs(args)...)
+}
+
+// Trace redacts and emits the message and key/value pairs at the trace level.
+func (l *redactingLogger) Trace(msg string, args ...interface{}) {
+	l.Logger.Trace(redactLogValue(msg), redactLogArgs(args)...)
+}
+
+// Debug redacts and emits the message and key/value pairs at the debug level.
+func (l *redactingLogger) Debug(msg string, args ...interface{}) {
+	l.Logger.Debug(redactLogValue(msg), redactLogArgs(args)...)
+}
+
+// Info redacts and emits the message and key/value pairs at the info level.
+func (l *redactingLogger) Info(msg string, args ...interface{}) {
+	l.Logger.Info(redactLogValue(msg), redactLogArgs(args)...)
+}
+
+// Warn redacts and emits the message and key/value pairs at the warn level.
+func (l *redactingLogger) Warn(msg string, args ...interface{}) {
+	l.Logger.Warn(redactLogValue(msg), redactLogArgs(args)...)
+}
+
+// Error redacts and emits the message and key/value pairs at the error level.
+func (l *redactingLogger) Error(msg string, args ...interface{}) {
+	l.Logger.Error(redactLogValue(msg), redactLogArgs(args)...)
+}
+
+// With returns a redacting sub-logger with the redacted key/value pairs.
+func (l *redactingLogger) With(args ...interface{}) hclog.Logger {
+	return &redactingLogger{Logger: l.Logger.With(redactLogArgs(args)...)}
+}
+
+// Named returns a redacting sub-logger with the name appended.
+func (l *redactingLogger) Named(name string) hclog.Logger {
+	return &redactingLogger{Logger: l.Logger.Named(name)}
+}
+
+// ResetNamed returns a redacting sub-logger with the given name.
+func (l *redactingLogger) ResetNamed(name string) hclog.Logger {
+	return &redactingLogger{Logger: l.Logger.ResetNamed(name)}
+}
+
+// redactLogArgs redacts the values of sensitive keys, and secrets in the other values, of key/value pairs.
+func redactLogArgs(args []interface{}) []interface{} {
+	redactedArgs := make([]interface{}, len(args))
+
+	for i := 0; i < len(args); i++ {
+		redactedArgs[i] = args[i]
+
+		if i%2 == 0 {
+			continue
+		}
+
+		if key, ok := args[i-1].(string); ok && isSensitiveLogKey(key) {
+			redactedArgs[i] = redacted
+			continue
+		}
+
+		switch value := args[i].(type) {
+		case string:
+			redactedArgs[i] = redactLogValue(value)
+		case error:
+			redactedArgs[i] = redactLogValue(value.Error())
+		}
+	}
+
+	return redactedArgs
+}
+
+// isSensitiveLogKey reports whether the values of the log key must never be logged.
+func isSensitiveLogKey(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, sensitive := range sensitiveLogKeys {
+		if key == sensitive {
+			return true
+		}
+	}
+
+	for _, suffix := range sensitiveLogKeySuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactLogValue redacts bearer tokens, Ory API keys and Ory session tokens from a logged value.
+func redactLogValue(value string) string {
+	return sensitiveLogValue.ReplaceAllStringFunc(value, func(match string) string {
+		prefix := sensitiveLogValue.FindStringSubmatch(match)[1]
+		if strings.HasPrefix(strings.ToLower(prefix), "bearer") {
+			return prefix + redacted
+		}
+
+		return redacted
+	})
+}
+
+// redactingDumpTransport logs the headers of HTTP requests and responses with sensitive headers redacted.
+// It replaces the Kratos client's own debug output, which includes cookies and tokens.
+type redactingDumpTransport struct {
+	next   http.RoundTripper
+	logger hclog.Logger
+}
+
+// RoundTrip logs the redacted request and response headers around the request.
+func (t *redactingDumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	dump, err := httputil.DumpRequestOut(req, false)
+	if err == nil {
+		t.logger.Debug("kratos request", "dump", redactHTTPDump(dump))
+	}
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil {
+		return res, err
+	}
+
+	dump, err = httputil.DumpResponse(res, false)
+	if err == nil {
+		t.logger.Debug("kratos response", "dump", redactHTTPDump(dump))
+	}
+
+	return res, nil
+}
+
+// redactHTTPDump redacts sensitive headers and secrets from an HTTP dump.
+func redactHTTPDump(dump []byte) string {
+	return redactLogValue(sensitiveHTTPHeader.ReplaceAllString(string(dump), "$1: "+redacted))
+}
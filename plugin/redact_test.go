@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"testing"
+)
+
+func TestIsSensitiveLogKey(t *testing.T) {
+	tests := []struct {
+		key       string
+		sensitive bool
+	}{
+		{"cookie", true},
+		{"token", true},
+		{"jwt", true},
+		{"identity_grant", true},
+		{"kratos_session_cookie", true},
+		{"oauth2_access_token", true},
+		{"session_token", true},
+		{"ory_api_key", true},
+		{"api_key", true},
+		{"kratos_tls_client_key", true},
+		{"client_secret", true},
+		{"Authorization", true},
+		{"granted_by", false},
+		{"token_ttl", false},
+		{"token_bound_cidrs", false},
+		{"session_id", false},
+		{"identity_id", false},
+		{"denied_by", false},
+		{"namespace", false},
+		{"err", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			if got := isSensitiveLogKey(test.key); got != test.sensitive {
+				t.Errorf("isSensitiveLogKey(%q) = %t, want %t", test.key, got, test.sensitive)
+			}
+		})
+	}
+}
+
+func TestRedactLogArgs(t *testing.T) {
+	args := redactLogArgs([]interface{}{
+		"kratos_session_cookie", "ory_kratos_session=abc",
+		"granted_by", "operator",
+		"err", "request failed: Bearer ory_at_abc",
+	})
+
+	want := []interface{}{
+		"kratos_session_cookie", redacted,
+		"granted_by", "operator",
+		"err", "request failed: Bearer " + redacted,
+	}
+
+	for i := range want {
+		if args[i] != want[i] {
+			t.Errorf("args[%d] = %v, want %v", i, args[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package plugin
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	metrics "github.com/armon/go-metrics"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultUpstreamTimeout is the timeout of a single call to Kratos or Keto when none is configured.
+	defaultUpstreamTimeout = 5 * time.Second
+
+	// defaultUpstreamMaxRetries is the number of retries of a failed call when none is configured.
+	defaultUpstreamMaxRetries = 2
+
+	// defaultCircuitBreakerThreshold is the number of consecutive failures that open the circuit breaker
+	// when none is configured.
+	defaultCircuitBreakerThreshold = 5
+
+	// defaultCircuitBreakerCooldown is the time the circuit breaker stays open when none is configured.
+	defaultCircuitBreakerCooldown = 30 * time.Second
+
+	// upstreamRetryBaseDelay is the base delay of the exponential backoff between retries.
+	upstreamRetryBaseDelay = 100 * time.Millisecond
+
+	// upstreamRetryMaxDelay is the maximum delay between retries.
+	upstreamRetryMaxDelay = 2 * time.Second
+)
+
+// errCircuitOpen is returned without calling the upstream while its circuit breaker is open.
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// retryableError marks an error of an upstream call as retryable.
+type retryableError struct {
+	err error
+}
+
+// Error returns the message of the wrapped error.
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// upstreamAnswerError marks an error of an upstream call as a definitive answer of the upstream.
+type upstreamAnswerError struct {
+	err error
+}
+
+// Error returns the message of the wrapped error.
+func (e *upstreamAnswerError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *upstreamAnswerError) Unwrap() error {
+	return e.err
+}
+
+// callPolicy applies a timeout, retries and a circuit breaker to the calls to an upstream.
+type callPolicy struct {
+	// name is the name of the upstream, used in errors.
+	name string
+
+	// timeout is the timeout of a single attempt.
+	timeout time.Duration
+
+	// maxRetries is the number of times a retryable failure is retried.
+	maxRetries int
+
+	// breaker is the circuit breaker of the upstream, or nil if disabled.
+	breaker *circuitBreaker
+}
+
+// newCallPolicy creates the call policy of an upstream from the plugin configuration.
+func newCallPolicy(name string, config *Config) *callPolicy {
+	resilience := defaultConfig().Resilience
+	if config != nil && config.Resilience != nil {
+		resilience = config.Resilience
+	}
+
+	policy := &callPolicy{
+		name:       name,
+		timeout:    resilience.Timeout,
+		maxRetries: resilience.MaxRetries,
+	}
+
+	if resilience.BreakerThreshold > 0 {
+		policy.breaker = &circuitBreaker{
+			name:      name,
+			threshold: resilience.BreakerThreshold,
+			cooldown:  resilience.BreakerCooldown,
+		}
+	}
+
+	return policy
+}
+
+// do calls fn with a per attempt timeout, retrying retryable failures with jittered exponential backoff.
+// It fails fast while the circuit breaker is open.
+// The duration of each attempt and the number of retries are recorded as metrics.
+func (p *callPolicy) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	labels := []metrics.Label{{Name: "upstream", Value: p.name}}
+
+	for attempt := 0; ; attempt++ {
+		if p.breaker != nil && !p.breaker.allow() {
+			metrics.IncrCounterWithLabels(metricCircuitBreakerRejected, 1, labels)
+
+			return errors.Wrapf(errCircuitOpen, "%s is unavailable, retry later", p.name)
+		}
+
+		if attempt > 0 {
+			metrics.IncrCounterWithLabels(metricUpstreamRetries, 1, labels)
+		}
+
+		err := p.attempt(ctx, fn)
+
+		// A call given up by the caller says nothing about the health of the upstream.
+		if ctx.Err() != nil {
+			if p.breaker != nil {
+				p.breaker.abandon()
+			}
+
+			return err
+		}
+
+		if p.breaker != nil {
+			p.breaker.record(err == nil || isUpstreamAnswer(err))
+		}
+
+		if err == nil || !isRetryable(err) || attempt >= p.maxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryDelay(attempt)):
+		}
+	}
+}
+
+// detach returns a context for a call shared by several callers, such as a coalesced call,
+// which is not cancelled with the caller's context but carries its trace span.
+// It expires once every attempt and retry delay the policy allows could have run.
+func (p *callPolicy) detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
+
+	if p.timeout <= 0 {
+		return context.WithCancel(detached)
+	}
+
+	budget := time.Duration(p.maxRetries+1)*p.timeout + time.Duration(p.maxRetries)*upstreamRetryMaxDelay
+
+	return context.WithTimeout(detached, budget)
+}
+
+// attempt calls fn once with the per attempt timeout, and measures its duration by outcome.
+func (p *callPolicy) attempt(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func(start time.Time) {
+		outcome := loginOutcomeSuccess
+		if err != nil {
+			outcome = "error"
+		}
+
+		metrics.MeasureSinceWithLabels(metricUpstreamLatency, start, []metrics.Label{
+			{Name: "upstream", Value: p.name},
+			{Name: "outcome", Value: outcome},
+		})
+	}(time.Now())
+
+	if p.timeout <= 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	return fn(ctx)
+}
+
+// retryDelay returns the jittered delay before the retry following the given attempt.
+func retryDelay(attempt int) time.Duration {
+	delay := upstreamRetryBaseDelay << attempt
+	if delay <= 0 || delay > upstreamRetryMaxDelay {
+		delay = upstreamRetryMaxDelay
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// isRetryable reports whether a failed upstream call may succeed if retried:
+// errors marked as retryable, timeouts, network errors and gRPC Unavailable errors.
+func isRetryable(err error) bool {
+	var retryable *retryableError
+	if errors.As(err, &retryable) {
+		return true
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	switch status.Code(errors.Cause(err)) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+
+	return false
+}
+
+// isUpstreamAnswer reports whether a failed upstream call was answered definitively by the upstream,
+// such as with a 4xx response from Kratos or a PermissionDenied error from Keto,
+// which shows the upstream is healthy.
+func isUpstreamAnswer(err error) bool {
+	var answer *upstreamAnswerError
+	if errors.As(err, &answer) {
+		return true
+	}
+
+	switch status.Code(errors.Cause(err)) {
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.FailedPrecondition, codes.OutOfRange, codes.Unauthenticated:
+		return true
+	}
+
+	return false
+}
+
+// circuitBreaker fails calls fast after consecutive failures, until a trial call succeeds after a cooldown.
+type circuitBreaker struct {
+	// name is the name of the upstream, used to label the breaker state metric.
+	name string
+
+	// threshold is the number of consecutive failures that open the breaker.
+	threshold int
+
+	// cooldown is the time the breaker stays open before a trial call is allowed.
+	cooldown time.Duration
+
+	mutex sync.Mutex
+
+	// failures is the number of consecutive failures.
+	failures int
+
+	// openUntil is when the breaker allows a trial call, if it is open.
+	openUntil time.Time
+
+	// trial is true while a trial call is in flight.
+	trial bool
+}
+
+// allow reports whether a call may be made.
+// Once the cooldown has passed, a single trial call is allowed at a time.
+func (b *circuitBreaker) allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+
+	if b.trial || time.Now().Before(b.openUntil) {
+		return false
+	}
+
+	b.trial = true
+
+	return true
+}
+
+// record records the outcome of a call, opening or closing the breaker.
+// The breaker state metric is set whenever the breaker opens or closes.
+func (b *circuitBreaker) record(success bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.trial = false
+
+	wasOpen := b.failures >= b.threshold
+
+	if success {
+		b.failures = 0
+	} else {
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openUntil = time.Now().Add(b.cooldown)
+		}
+	}
+
+	if isOpen := b.failures >= b.threshold; isOpen != wasOpen {
+		var state float32
+		if isOpen {
+			state = 1
+		}
+
+		metrics.SetGaugeWithLabels(metricCircuitBreakerOpen, state, []metrics.Label{{Name: "upstream", Value: b.name}})
+	}
+}
+
+// abandon ends a call whose outcome is not recorded, such as one given up by the caller,
+// so the breaker allows another trial call if it was one.
+func (b *circuitBreaker) abandon() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.trial = false
+}
@@ -0,0 +1,185 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCallPolicyRetries(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		{name: "success", err: nil, calls: 1},
+		{name: "retryable", err: &retryableError{err: errors.New("unavailable")}, calls: 3},
+		{name: "unavailable", err: status.Error(codes.Unavailable, "unavailable"), calls: 3},
+		{name: "answer", err: &upstreamAnswerError{err: errors.New("unauthorized")}, calls: 1},
+		{name: "permission denied", err: status.Error(codes.PermissionDenied, "denied"), calls: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			policy := &callPolicy{name: "test", timeout: time.Second, maxRetries: 2}
+
+			calls := 0
+			err := policy.do(context.Background(), func(ctx context.Context) error {
+				calls++
+
+				return test.err
+			})
+
+			if calls != test.calls {
+				t.Errorf("called %d times, want %d", calls, test.calls)
+			}
+
+			if errors.Cause(err) != errors.Cause(test.err) {
+				t.Errorf("err = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestCallPolicyDoesNotRetryGivenUpCalls(t *testing.T) {
+	policy := &callPolicy{name: "test", timeout: time.Second, maxRetries: 2}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	calls := 0
+	err := policy.do(ctx, func(ctx context.Context) error {
+		calls++
+		cancel()
+
+		return &retryableError{err: ctx.Err()}
+	})
+
+	if err == nil || calls != 1 {
+		t.Errorf("called %d times with err %v, want 1 call and an error", calls, err)
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	failure := func(ctx context.Context) error {
+		return &retryableError{err: errors.New("unavailable")}
+	}
+
+	success := func(ctx context.Context) error {
+		return nil
+	}
+
+	answer := func(ctx context.Context) error {
+		return status.Error(codes.PermissionDenied, "denied")
+	}
+
+	newPolicy := func() *callPolicy {
+		return &callPolicy{
+			name:    "test",
+			timeout: time.Second,
+			breaker: &circuitBreaker{name: "test", threshold: 2, cooldown: 50 * time.Millisecond},
+		}
+	}
+
+	t.Run("opens after consecutive failures", func(t *testing.T) {
+		policy := newPolicy()
+
+		_ = policy.do(context.Background(), failure)
+		_ = policy.do(context.Background(), failure)
+
+		err := policy.do(context.Background(), success)
+		if !errors.Is(err, errCircuitOpen) {
+			t.Fatalf("err = %v, want open circuit", err)
+		}
+	})
+
+	t.Run("answers do not open it", func(t *testing.T) {
+		policy := newPolicy()
+
+		for i := 0; i < 3; i++ {
+			_ = policy.do(context.Background(), answer)
+		}
+
+		err := policy.do(context.Background(), success)
+		if err != nil {
+			t.Fatalf("err = %v, want closed circuit", err)
+		}
+	})
+
+	t.Run("given up calls do not open it", func(t *testing.T) {
+		policy := newPolicy()
+
+		for i := 0; i < 3; i++ {
+			ctx, cancel := context.WithCancel(context.Background())
+			_ = policy.do(ctx, func(ctx context.Context) error {
+				cancel()
+
+				return ctx.Err()
+			})
+		}
+
+		err := policy.do(context.Background(), success)
+		if err != nil {
+			t.Fatalf("err = %v, want closed circuit", err)
+		}
+	})
+
+	t.Run("closes after a successful trial", func(t *testing.T) {
+		policy := newPolicy()
+
+		_ = policy.do(context.Background(), failure)
+		_ = policy.do(context.Background(), failure)
+
+		time.Sleep(60 * time.Millisecond)
+
+		err := policy.do(context.Background(), success)
+		if err != nil {
+			t.Fatalf("trial err = %v, want nil", err)
+		}
+
+		err = policy.do(context.Background(), success)
+		if err != nil {
+			t.Fatalf("err = %v, want closed circuit", err)
+		}
+	})
+
+	t.Run("reopens after a failed trial", func(t *testing.T) {
+		policy := newPolicy()
+
+		_ = policy.do(context.Background(), failure)
+		_ = policy.do(context.Background(), failure)
+
+		time.Sleep(60 * time.Millisecond)
+
+		_ = policy.do(context.Background(), failure)
+
+		err := policy.do(context.Background(), success)
+		if !errors.Is(err, errCircuitOpen) {
+			t.Fatalf("err = %v, want open circuit", err)
+		}
+	})
+
+	t.Run("allows another trial after a given up trial", func(t *testing.T) {
+		policy := newPolicy()
+
+		_ = policy.do(context.Background(), failure)
+		_ = policy.do(context.Background(), failure)
+
+		time.Sleep(60 * time.Millisecond)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		_ = policy.do(ctx, func(ctx context.Context) error {
+			cancel()
+
+			return ctx.Err()
+		})
+
+		err := policy.do(context.Background(), success)
+		if err != nil {
+			t.Fatalf("err = %v, want a trial call", err)
+		}
+	})
+}
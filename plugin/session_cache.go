@@ -0,0 +1,194 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/hashicorp/vault/sdk/logical"
+	kratos "github.com/ory/kratos-client-go"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultSessionCacheSize is the maximum number of cached Kratos sessions when none is configured.
+	defaultSessionCacheSize = 1024
+)
+
+// SessionCache is an in-memory LRU cache of validated Kratos sessions, keyed by a hash of the session cookie.
+type SessionCache struct {
+	// cache holds the sessionCacheEntry of each cached session.
+	cache *lru.Cache
+
+	// ttl is the maximum time a session is cached for.
+	ttl time.Duration
+}
+
+// sessionCacheEntry is a cached Kratos session.
+type sessionCacheEntry struct {
+	// session is the validated Kratos session.
+	session *kratos.Session
+
+	// expiresAt is when the entry expires, at the latest when the session does.
+	expiresAt time.Time
+}
+
+// getSessionCache returns the cache of validated Kratos sessions.
+func (b *OryAuthBackend) getSessionCache(
+	ctx context.Context,
+	s logical.Storage,
+) (*SessionCache, error) {
+	b.sessionCacheMutex.RLock()
+	sessionCache := b.sessionCache
+	b.sessionCacheMutex.RUnlock()
+
+	if sessionCache != nil {
+		return sessionCache, nil
+	}
+
+	b.sessionCacheMutex.Lock()
+	defer b.sessionCacheMutex.Unlock()
+
+	if b.sessionCache != nil {
+		return b.sessionCache, nil
+	}
+
+	config, err := b.readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionCache, err = newSessionCache(config)
+	if err != nil {
+		return nil, err
+	}
+
+	b.sessionCache = sessionCache
+
+	return b.sessionCache, nil
+}
+
+// newSessionCache creates a cache of validated Kratos sessions from the plugin configuration.
+// If session caching is disabled, the cache is empty and never holds sessions,
+// so it is not created again for every login.
+func newSessionCache(config *Config) (*SessionCache, error) {
+	if config == nil || config.SessionCache == nil || config.SessionCache.TTL <= 0 || config.SessionCache.Size <= 0 {
+		return &SessionCache{}, nil
+	}
+
+	cache, err := lru.New(config.SessionCache.Size)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create session cache")
+	}
+
+	return &SessionCache{
+		cache: cache,
+		ttl:   config.SessionCache.TTL,
+	}, nil
+}
+
+// closeSessionCache purges and drops the cache of validated Kratos sessions.
+func (b *OryAuthBackend) closeSessionCache() {
+	b.sessionCacheMutex.Lock()
+	defer b.sessionCacheMutex.Unlock()
+
+	if b.sessionCache == nil || b.sessionCache.cache == nil {
+		b.sessionCache = nil
+
+		return
+	}
+
+	b.sessionCache.cache.Purge()
+
+	b.sessionCache = nil
+}
+
+// get returns the cached session for the cookie, or nil if it is not cached or has expired.
+func (c *SessionCache) get(cookie string) *kratos.Session {
+	if c.cache == nil {
+		return nil
+	}
+
+	key := sessionCacheKey(cookie)
+
+	val, ok := c.cache.Get(key)
+	if !ok {
+		recordCacheLookup(cacheNameSession, false)
+
+		return nil
+	}
+
+	entry := val.(*sessionCacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		c.cache.Remove(key)
+		recordCacheLookup(cacheNameSession, false)
+
+		return nil
+	}
+
+	recordCacheLookup(cacheNameSession, true)
+
+	return entry.session
+}
+
+// add caches the session for the cookie, for the cache TTL but no longer than the session is valid.
+func (c *SessionCache) add(cookie string, session *kratos.Session) {
+	if c.cache == nil {
+		return
+	}
+
+	expiresAt := time.Now().Add(c.ttl)
+	if session.ExpiresAt != nil && session.ExpiresAt.Before(expiresAt) {
+		expiresAt = *session.ExpiresAt
+	}
+
+	if !time.Now().Before(expiresAt) {
+		return
+	}
+
+	c.cache.Add(sessionCacheKey(cookie), &sessionCacheEntry{
+		session:   session,
+		expiresAt: expiresAt,
+	})
+}
+
+// remove removes the cached sessions with the session ID, or of the identity ID, whichever is set,
+// or every cached session if neither is. It returns the number of sessions removed.
+func (c *SessionCache) remove(sessionID string, identityID string) int {
+	if c.cache == nil {
+		return 0
+	}
+
+	if sessionID == "" && identityID == "" {
+		removed := c.cache.Len()
+		c.cache.Purge()
+
+		return removed
+	}
+
+	removed := 0
+	for _, key := range c.cache.Keys() {
+		val, ok := c.cache.Peek(key)
+		if !ok {
+			continue
+		}
+
+		session := val.(*sessionCacheEntry).session
+		if (sessionID != "" && session.Id == sessionID) || (identityID != "" && session.Identity.Id == identityID) {
+			c.cache.Remove(key)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// sessionCacheKey returns the cache key of a session cookie.
+// Cookies are cached by hash, so the cache does not hold usable cookies.
+func sessionCacheKey(cookie string) string {
+	hash := sha256.Sum256([]byte(cookie))
+
+	return hex.EncodeToString(hash[:])
+}
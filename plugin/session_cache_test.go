@@ -0,0 +1,174 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	kratos "github.com/ory/kratos-client-go"
+)
+
+func TestSessionCacheRemove(t *testing.T) {
+	newCache := func(t *testing.T) *SessionCache {
+		sessionCache, err := newSessionCache(&Config{
+			SessionCache: &SessionCacheConfig{Size: 16, TTL: time.Minute},
+		})
+		if err != nil {
+			t.Fatalf("creating session cache: %v", err)
+		}
+
+		sessionCache.add("cookie-a1", &kratos.Session{Id: "session-a1", Identity: kratos.Identity{Id: "alice"}})
+		sessionCache.add("cookie-a2", &kratos.Session{Id: "session-a2", Identity: kratos.Identity{Id: "alice"}})
+		sessionCache.add("cookie-b1", &kratos.Session{Id: "session-b1", Identity: kratos.Identity{Id: "bob"}})
+
+		return sessionCache
+	}
+
+	tests := []struct {
+		name       string
+		sessionID  string
+		identityID string
+		removed    int
+		cached     []string
+	}{
+		{name: "session", sessionID: "session-a1", removed: 1, cached: []string{"cookie-a2", "cookie-b1"}},
+		{name: "identity", identityID: "alice", removed: 2, cached: []string{"cookie-b1"}},
+		{name: "unknown session", sessionID: "session-c1", removed: 0, cached: []string{"cookie-a1", "cookie-a2", "cookie-b1"}},
+		{name: "all", removed: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sessionCache := newCache(t)
+
+			if removed := sessionCache.remove(test.sessionID, test.identityID); removed != test.removed {
+				t.Errorf("removed %d sessions, want %d", removed, test.removed)
+			}
+
+			if sessionCache.cache.Len() != len(test.cached) {
+				t.Errorf("%d sessions cached, want %d", sessionCache.cache.Len(), len(test.cached))
+			}
+
+			for _, cookie := range test.cached {
+				if sessionCache.get(cookie) == nil {
+					t.Errorf("session of %s was removed", cookie)
+				}
+			}
+		})
+	}
+}
+
+func TestSessionCacheTTL(t *testing.T) {
+	sessionCache, err := newSessionCache(&Config{
+		SessionCache: &SessionCacheConfig{Size: 16, TTL: time.Minute},
+	})
+	if err != nil {
+		t.Fatalf("creating session cache: %v", err)
+	}
+
+	expiringSoon := time.Now().Add(10 * time.Second)
+	expired := time.Now().Add(-time.Second)
+	expiringLater := time.Now().Add(time.Hour)
+
+	sessionCache.add("cookie-soon", &kratos.Session{Id: "session-soon", ExpiresAt: &expiringSoon})
+	sessionCache.add("cookie-expired", &kratos.Session{Id: "session-expired", ExpiresAt: &expired})
+	sessionCache.add("cookie-later", &kratos.Session{Id: "session-later", ExpiresAt: &expiringLater})
+
+	val, ok := sessionCache.cache.Peek(sessionCacheKey("cookie-soon"))
+	if !ok || !val.(*sessionCacheEntry).expiresAt.Equal(expiringSoon) {
+		t.Errorf("session expiring before the cache TTL is not cached until it expires: %v", val)
+	}
+
+	if sessionCache.get("cookie-expired") != nil {
+		t.Error("expired session was cached")
+	}
+
+	val, ok = sessionCache.cache.Peek(sessionCacheKey("cookie-later"))
+	if !ok || val.(*sessionCacheEntry).expiresAt.After(time.Now().Add(time.Minute)) {
+		t.Errorf("session is cached for longer than the cache TTL: %v", val)
+	}
+
+	sessionCache.cache.Add(sessionCacheKey("cookie-stale"), &sessionCacheEntry{
+		session:   &kratos.Session{Id: "session-stale"},
+		expiresAt: time.Now().Add(-time.Millisecond),
+	})
+
+	if sessionCache.get("cookie-stale") != nil {
+		t.Error("stale cache entry was returned")
+	}
+}
+
+// startTestKratosCounting serves a Kratos public API like startTestKratos,
+// and returns its URL and the number of sessions validated.
+func startTestKratosCounting(t *testing.T, identityID string) (string, *atomic.Int64) {
+	t.Helper()
+
+	validations := &atomic.Int64{}
+	handler := testKratosSessionHandler(identityID)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		validations.Add(1)
+		handler(w, r)
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server.URL, validations
+}
+
+func TestLoginUsesSessionCache(t *testing.T) {
+	b, s := newTestBackend(t)
+	startTestKeto(t, b, &testKetoCheckServer{})
+
+	kratosURL, validations := startTestKratosCounting(t, "alice")
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"kratos_public_url": kratosURL,
+		"kratos_admin_url":  kratosURL,
+		"session_cache_ttl": 60,
+	})
+
+	login := func() {
+		t.Helper()
+
+		res, err := testLogin(b, s, "reports")
+		if err != nil || res == nil || res.Auth == nil {
+			t.Fatalf("logging in: %v %v", res, err)
+		}
+	}
+
+	login()
+	login()
+
+	if got := validations.Load(); got != 1 {
+		t.Fatalf("%d session validations for two logins, want 1", got)
+	}
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "session_cache/invalidate",
+		Storage:   s,
+		Data:      map[string]interface{}{"identity_id": "alice"},
+	})
+	if err != nil || res == nil || res.Data["removed"] != 1 {
+		t.Fatalf("invalidating session cache: %v %v", res, err)
+	}
+
+	login()
+
+	if got := validations.Load(); got != 2 {
+		t.Fatalf("%d session validations after invalidation, want 2", got)
+	}
+
+	// Writing the config purges the cache.
+	writeTestConfig(t, b, s, map[string]interface{}{})
+
+	login()
+
+	if got := validations.Load(); got != 3 {
+		t.Errorf("%d session validations after a config write, want 3", got)
+	}
+}
@@ -0,0 +1,257 @@
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/consts"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultTokenTTL is the TTL of issued tokens when none is configured.
+	// It is kept short, as it bounds how long a token of a denied identity or session stays valid
+	// when the plugin cannot revoke it.
+	defaultTokenTTL = 15 * time.Minute
+
+	// defaultTokenMaxTTL is the time issued tokens can be renewed for when none is configured.
+	defaultTokenMaxTTL = 1 * time.Hour
+
+	// trackedTokenStoragePrefix is the storage prefix of the tokens tracked for revocation, keyed by accessor.
+	trackedTokenStoragePrefix = "tokens/"
+)
+
+// trackedToken is a token tracked so it can be revoked once its identity or session is denied.
+type trackedToken struct {
+	Subject   string    `json:"subject"`
+	SessionID string    `json:"session_id,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// getTokenConfig returns the token configuration, or the default one if the plugin is not configured.
+func getTokenConfig(config *Config) *TokenConfig {
+	if config == nil || config.Token == nil {
+		return defaultConfig().Token
+	}
+
+	return config.Token
+}
+
+// capTTL returns the TTL capped at the limit. A zero TTL, which Vault replaces with the system default, is capped too.
+func capTTL(ttl time.Duration, limit time.Duration) time.Duration {
+	if ttl == 0 || ttl > limit {
+		return limit
+	}
+
+	return ttl
+}
+
+// tokenPrincipal returns the principal a token was issued to, from its internal data.
+func tokenPrincipal(auth *logical.Auth) *loginPrincipal {
+	subject, _ := auth.InternalData["subject"].(string)
+	sessionID, _ := auth.InternalData["session_id"].(string)
+
+	principal := &loginPrincipal{Subject: subject, SessionID: sessionID}
+
+	if val, ok := auth.InternalData["expires_at"].(string); ok {
+		expiresAt, err := time.Parse(time.RFC3339Nano, val)
+		if err == nil {
+			principal.ExpiresAt = &expiresAt
+		}
+	}
+
+	return principal
+}
+
+// authRenewHandler renews tokens unless their identity or session has been denied since they were issued,
+// or the credential they were issued for has expired.
+func (b *OryAuthBackend) authRenewHandler(
+	ctx context.Context,
+	req *logical.Request,
+	_ *framework.FieldData,
+) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, errors.New("request auth was nil")
+	}
+
+	res, err := b.renewToken(ctx, req)
+	recordTokenRenewal(req, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// renewToken returns the renewed auth of the request, with the configured lifetimes capped by the credential's expiry.
+// If revocation is enabled, the token is tracked from its first renewal, when its accessor is first known to the plugin.
+func (b *OryAuthBackend) renewToken(ctx context.Context, req *logical.Request) (*logical.Response, error) {
+	principal := tokenPrincipal(req.Auth)
+
+	err := b.checkDenied(ctx, req.Storage, principal)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := b.readConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenConfig := getTokenConfig(config)
+
+	res := &logical.Response{Auth: req.Auth}
+	res.Auth.TTL = tokenConfig.TTL
+	res.Auth.MaxTTL = tokenConfig.MaxTTL
+	res.Auth.Period = tokenConfig.Period
+
+	if principal.ExpiresAt != nil {
+		untilExpiry := time.Until(*principal.ExpiresAt)
+		if untilExpiry <= 0 {
+			return nil, unauthenticatedError(errors.New("the credential the token was issued for has expired"))
+		}
+
+		res.Auth.TTL = capTTL(res.Auth.TTL, untilExpiry)
+		if res.Auth.Period > 0 {
+			res.Auth.Period = capTTL(res.Auth.Period, untilExpiry)
+		}
+	}
+
+	if tokenConfig.revocationEnabled() && req.Auth.Accessor != "" {
+		ttl := res.Auth.TTL
+		if res.Auth.Period > 0 {
+			ttl = res.Auth.Period
+		}
+
+		err = trackToken(ctx, req.Storage, req.Auth.Accessor, principal, time.Now().Add(ttl))
+		if err != nil {
+			b.Logger().Warn("failed to track token for revocation", "err", err)
+		}
+	}
+
+	return res, nil
+}
+
+// trackToken stores the token's principal under its accessor, until the token expires.
+func trackToken(
+	ctx context.Context,
+	s logical.Storage,
+	accessor string,
+	principal *loginPrincipal,
+	expiresAt time.Time,
+) error {
+	entry, err := logical.StorageEntryJSON(trackedTokenStoragePrefix+accessor, &trackedToken{
+		Subject:   principal.Subject,
+		SessionID: principal.SessionID,
+		ExpiresAt: expiresAt.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = s.Put(ctx, entry)
+	if err != nil {
+		return errors.Wrap(err, "failed to write tracked token")
+	}
+
+	return nil
+}
+
+// revokeDeniedTokens revokes the tracked tokens of denied identities and sessions through the Vault API,
+// and forgets tracked tokens once they have expired, or if revocation has been disabled.
+// Tokens which cannot be revoked are tried again on the next run.
+func (b *OryAuthBackend) revokeDeniedTokens(ctx context.Context, req *logical.Request) error {
+	s := req.Storage
+
+	if b.System().ReplicationState().HasState(consts.ReplicationPerformanceStandby) {
+		return nil
+	}
+
+	accessors, err := s.List(ctx, trackedTokenStoragePrefix)
+	if err != nil {
+		return errors.Wrap(err, "failed to list tracked tokens")
+	}
+
+	if len(accessors) == 0 {
+		return nil
+	}
+
+	config, err := b.readConfig(ctx, s)
+	if err != nil {
+		return err
+	}
+
+	tokenConfig := getTokenConfig(config)
+
+	var client *api.Client
+	if tokenConfig.revocationEnabled() {
+		client, err = newRevocationClient(tokenConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, accessor := range accessors {
+		entry, err := s.Get(ctx, trackedTokenStoragePrefix+accessor)
+		if err != nil {
+			return errors.Wrap(err, "failed to read tracked token")
+		}
+
+		if entry == nil {
+			continue
+		}
+
+		token := &trackedToken{}
+		err = entry.DecodeJSON(token)
+		if err == nil && client != nil && time.Now().Before(token.ExpiresAt) {
+			err = b.checkDenied(ctx, s, &loginPrincipal{Subject: token.Subject, SessionID: token.SessionID})
+			if err == nil {
+				continue
+			}
+
+			if loginErrorCode(err) != loginErrorPermissionDenied {
+				return err
+			}
+
+			err = client.Auth().Token().RevokeAccessorWithContext(ctx, accessor)
+			recordTokenRevocation(req, err)
+			if err != nil {
+				b.Logger().Warn("failed to revoke token of denied identity or session",
+					"identity_id", token.Subject, "session_id", token.SessionID, "err", err)
+
+				continue
+			}
+
+			b.Logger().Info("revoked token of denied identity or session", "identity_id", token.Subject, "session_id", token.SessionID)
+		}
+
+		err = s.Delete(ctx, trackedTokenStoragePrefix+accessor)
+		if err != nil {
+			return errors.Wrap(err, "failed to delete tracked token")
+		}
+	}
+
+	return nil
+}
+
+// newRevocationClient creates the Vault API client used to revoke tokens.
+func newRevocationClient(config *TokenConfig) (*api.Client, error) {
+	clientConfig := api.DefaultConfig()
+	if clientConfig.Error != nil {
+		return nil, errors.Wrap(clientConfig.Error, "failed to configure revocation client")
+	}
+
+	clientConfig.Address = config.RevocationAddress
+
+	client, err := api.NewClient(clientConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create revocation client")
+	}
+
+	client.SetToken(config.RevocationToken)
+
+	return client, nil
+}
@@ -0,0 +1,220 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// renewTestToken renews the token issued with the auth, as Vault's expiration manager does.
+func renewTestToken(b *OryAuthBackend, s logical.Storage, auth *logical.Auth) (*logical.Response, error) {
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login",
+		Storage:   s,
+		Auth:      auth,
+	})
+}
+
+// runTestPeriodic runs the periodic tasks of the backend, as Vault's rollback manager does.
+func runTestPeriodic(t *testing.T, b *OryAuthBackend, s logical.Storage) {
+	t.Helper()
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RollbackOperation,
+		Storage:   s,
+	})
+	if err != nil {
+		t.Fatalf("periodic tasks: %v", err)
+	}
+}
+
+// testVault is a Vault API recording the accessors of the tokens it is asked to revoke.
+type testVault struct {
+	mutex   sync.Mutex
+	revoked []string
+}
+
+// start serves the Vault API, and returns its address.
+func (v *testVault) start(t *testing.T) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/revoke-accessor" || r.Header.Get("X-Vault-Token") != "revocation-token" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+
+			return
+		}
+
+		body := map[string]string{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		v.mutex.Lock()
+		v.revoked = append(v.revoked, body["accessor"])
+		v.mutex.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	return server.URL
+}
+
+// revokedAccessors returns the accessors of the revoked tokens.
+func (v *testVault) revokedAccessors() []string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	return append([]string{}, v.revoked...)
+}
+
+func TestLoginIssuesRenewableTokens(t *testing.T) {
+	b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+
+	res, err := testLogin(b, s, "reports")
+	if err != nil || res == nil || res.Auth == nil {
+		t.Fatalf("login: %v %v", res, err)
+	}
+
+	if !res.Auth.Renewable || res.Auth.TTL != defaultTokenTTL || res.Auth.MaxTTL != defaultTokenMaxTTL || res.Auth.Period != 0 {
+		t.Errorf("unexpected default lifetimes: renewable %t, ttl %s, max ttl %s, period %s",
+			res.Auth.Renewable, res.Auth.TTL, res.Auth.MaxTTL, res.Auth.Period)
+	}
+
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"token_ttl":     "5m",
+		"token_max_ttl": "30m",
+		"token_period":  "10m",
+	})
+
+	res, err = testLogin(b, s, "reports")
+	if err != nil || res == nil || res.Auth == nil {
+		t.Fatalf("login: %v %v", res, err)
+	}
+
+	if res.Auth.TTL != 5*time.Minute || res.Auth.MaxTTL != 30*time.Minute || res.Auth.Period != 10*time.Minute {
+		t.Errorf("unexpected configured lifetimes: ttl %s, max ttl %s, period %s", res.Auth.TTL, res.Auth.MaxTTL, res.Auth.Period)
+	}
+
+	renewed, err := renewTestToken(b, s, res.Auth)
+	if err != nil || renewed == nil || renewed.Auth == nil {
+		t.Fatalf("renewal: %v %v", renewed, err)
+	}
+
+	if renewed.Auth.TTL != 5*time.Minute || renewed.Auth.Period != 10*time.Minute {
+		t.Errorf("unexpected renewed lifetimes: ttl %s, period %s", renewed.Auth.TTL, renewed.Auth.Period)
+	}
+}
+
+func TestRenewCappedByCredentialExpiry(t *testing.T) {
+	b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+
+	res, err := testLogin(b, s, "reports")
+	if err != nil || res == nil || res.Auth == nil {
+		t.Fatalf("login: %v %v", res, err)
+	}
+
+	auth := res.Auth
+	auth.InternalData["expires_at"] = time.Now().Add(time.Minute).Format(time.RFC3339Nano)
+
+	renewed, err := renewTestToken(b, s, auth)
+	if err != nil || renewed == nil || renewed.Auth == nil {
+		t.Fatalf("renewal: %v %v", renewed, err)
+	}
+
+	if renewed.Auth.TTL > time.Minute {
+		t.Errorf("renewed ttl = %s, want at most the minute until the credential expires", renewed.Auth.TTL)
+	}
+
+	auth.InternalData["expires_at"] = time.Now().Add(-time.Minute).Format(time.RFC3339Nano)
+
+	_, err = renewTestToken(b, s, auth)
+	if loginErrorCode(err) != loginErrorUnauthenticated {
+		t.Errorf("renewal after the credential expired returned %v, want unauthenticated", err)
+	}
+}
+
+func TestPeriodicRevokesDeniedTokens(t *testing.T) {
+	vault := &testVault{}
+
+	b, s := newTestLoginBackend(t, &testKetoCheckServer{})
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"revocation_vault_addr":  vault.start(t),
+		"revocation_vault_token": "revocation-token",
+	})
+
+	res, err := testLogin(b, s, "reports")
+	if err != nil || res == nil || res.Auth == nil {
+		t.Fatalf("login: %v %v", res, err)
+	}
+
+	auth := res.Auth
+	auth.Accessor = "accessor-alice"
+
+	_, err = renewTestToken(b, s, auth)
+	if err != nil {
+		t.Fatalf("renewal: %v", err)
+	}
+
+	err = trackToken(context.Background(), s, "accessor-expired", &loginPrincipal{Subject: "alice"}, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("tracking expired token: %v", err)
+	}
+
+	runTestPeriodic(t, b, s)
+
+	if revoked := vault.revokedAccessors(); len(revoked) != 0 {
+		t.Fatalf("revoked %v before the identity was denied", revoked)
+	}
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "deny/identities/alice",
+		Storage:   s,
+	})
+	if err != nil {
+		t.Fatalf("denying identity: %v", err)
+	}
+
+	runTestPeriodic(t, b, s)
+
+	if revoked := vault.revokedAccessors(); len(revoked) != 1 || revoked[0] != "accessor-alice" {
+		t.Errorf("revoked %v, want only accessor-alice", revoked)
+	}
+
+	accessors, err := s.List(context.Background(), trackedTokenStoragePrefix)
+	if err != nil {
+		t.Fatalf("listing tracked tokens: %v", err)
+	}
+
+	if len(accessors) != 0 {
+		t.Errorf("expected revoked and expired tokens to be forgotten, still tracking %v", accessors)
+	}
+}
+
+func TestRevocationRequiresToken(t *testing.T) {
+	b, s := newTestBackend(t)
+
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"verify_connection":     false,
+			"revocation_vault_addr": "https://127.0.0.1:8200",
+		},
+	})
+	if err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	if res == nil || !res.IsError() {
+		t.Errorf("expected revocation_vault_addr without revocation_vault_token to be rejected, got %v", res)
+	}
+}
@@ -0,0 +1,284 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/comnoco/vault-plugin-auth-ory/version"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// tracerName is the instrumentation name of the plugin's spans.
+	tracerName = "github.com/comnoco/vault-plugin-auth-ory/plugin"
+
+	// tracingServiceName is the service name spans are exported with.
+	tracingServiceName = "vault-plugin-auth-ory"
+
+	// defaultTracingSampleRatio is the ratio of logins traced when none is configured.
+	defaultTracingSampleRatio = 1.0
+
+	// defaultTracingURLPath is the path of the OTLP/HTTP traces endpoint when the endpoint URL has none.
+	defaultTracingURLPath = "/v1/traces"
+
+	// tracerShutdownTimeout is how long closing the tracer waits for spans to be exported.
+	tracerShutdownTimeout = 5 * time.Second
+)
+
+// traceContextPropagator propagates W3C trace context to Kratos and Keto.
+var traceContextPropagator = propagation.TraceContext{}
+
+// Tracer traces logins and exports their spans with OTLP.
+type Tracer struct {
+	// provider exports the spans, or is nil if tracing is disabled.
+	provider *sdktrace.TracerProvider
+
+	// tracer starts the root span of logins.
+	tracer trace.Tracer
+}
+
+// getTracer returns the tracer of logins.
+func (b *OryAuthBackend) getTracer(
+	ctx context.Context,
+	s logical.Storage,
+) (*Tracer, error) {
+	b.tracerMutex.RLock()
+	tracer := b.tracer
+	b.tracerMutex.RUnlock()
+
+	if tracer != nil {
+		return tracer, nil
+	}
+
+	b.tracerMutex.Lock()
+	defer b.tracerMutex.Unlock()
+
+	if b.tracer != nil {
+		return b.tracer, nil
+	}
+
+	config, err := b.readConfig(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+
+	tracer, err = newTracer(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	b.tracer = tracer
+
+	return b.tracer, nil
+}
+
+// newTracer creates the tracer of logins from the plugin configuration.
+// If tracing is disabled, the tracer starts no-op spans,
+// so it is not created again for every login.
+func newTracer(ctx context.Context, config *Config) (*Tracer, error) {
+	if config == nil || config.Tracing == nil || config.Tracing.Endpoint == "" {
+		return &Tracer{tracer: trace.NewNoopTracerProvider().Tracer(tracerName)}, nil
+	}
+
+	options, err := tracingExporterOptions(config.Tracing.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid tracing_otlp_endpoint")
+	}
+
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create otlp trace exporter")
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.Tracing.SampleRatio))),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(tracingServiceName),
+			semconv.ServiceVersionKey.String(version.Version),
+		)),
+	)
+
+	return &Tracer{
+		provider: provider,
+		tracer:   provider.Tracer(tracerName),
+	}, nil
+}
+
+// tracingExporterOptions returns the OTLP/HTTP exporter options for the endpoint URL.
+// Plain http endpoints are exported to without TLS.
+func tracingExporterOptions(endpoint string) ([]otlptracehttp.Option, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.New("endpoint must be an http or https URL")
+	}
+
+	urlPath := u.Path
+	if urlPath == "" || urlPath == "/" {
+		urlPath = defaultTracingURLPath
+	}
+
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithURLPath(urlPath),
+	}
+
+	if u.Scheme == "http" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	return options, nil
+}
+
+// closeTracer drops the tracer of logins, so the next login creates a new one,
+// and exports its remaining spans in the background, so logins are not held up meanwhile.
+func (b *OryAuthBackend) closeTracer() {
+	b.tracerMutex.Lock()
+	tracer := b.tracer
+	b.tracer = nil
+	b.tracerMutex.Unlock()
+
+	if tracer == nil || tracer.provider == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracerShutdownTimeout)
+		defer cancel()
+
+		err := tracer.provider.Shutdown(ctx)
+		if err != nil {
+			b.Logger().Warn("failed to export remaining spans", "err", err)
+		}
+	}()
+}
+
+// startLoginSpan starts the root span of a login.
+// Logins are not failed if the tracer cannot be created, but are not traced either.
+func (b *OryAuthBackend) startLoginSpan(
+	ctx context.Context,
+	req *logical.Request,
+	method string,
+) (context.Context, trace.Span) {
+	tracer, err := b.getTracer(ctx, req.Storage)
+	if err != nil {
+		b.Logger().Warn("could not get tracer, login is not traced", "err", err)
+
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	return tracer.tracer.Start(ctx, "ory.login", trace.WithAttributes(
+		attribute.String("vault.mount", req.MountPoint),
+		attribute.String("ory.login.method", method),
+	))
+}
+
+// startSpan starts a child span of the span in the context.
+// Without a span in the context, the span is a no-op.
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan ends the span, recording the error and its login error code if the operation failed.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttributes(attribute.String("ory.error_code", loginErrorCode(err)))
+		span.SetStatus(otelcodes.Error, loginErrorCode(err))
+	}
+
+	span.End()
+}
+
+// traceContextTransport injects the W3C trace context of the request context into Kratos requests.
+type traceContextTransport struct {
+	// next is the transport the request is sent with, or http.DefaultTransport if nil.
+	next http.RoundTripper
+}
+
+// RoundTrip injects the trace context into a copy of the request and sends it.
+func (t *traceContextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	if trace.SpanContextFromContext(req.Context()).IsValid() {
+		req = req.Clone(req.Context())
+		traceContextPropagator.Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	}
+
+	return next.RoundTrip(req)
+}
+
+// traceContextUnaryClientInterceptor injects the W3C trace context of the call context into Keto gRPC metadata.
+func traceContextUnaryClientInterceptor(
+	ctx context.Context,
+	method string,
+	req interface{},
+	reply interface{},
+	cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker,
+	opts ...grpc.CallOption,
+) error {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+
+	traceContextPropagator.Inject(ctx, metadataCarrier(md))
+
+	return invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, opts...)
+}
+
+// metadataCarrier carries trace context in gRPC metadata.
+type metadataCarrier metadata.MD
+
+// Get returns the first value of the key.
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// Set sets the value of the key.
+func (c metadataCarrier) Set(key string, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+// Keys returns the keys of the metadata.
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
@@ -0,0 +1,41 @@
+package plugin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestCloseTracerDoesNotHoldLoginsWhileExporting(t *testing.T) {
+	exporting := make(chan struct{})
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-exporting
+	}))
+	defer collector.Close()
+	defer close(exporting)
+
+	b, s := newTestBackend(t)
+	writeTestConfig(t, b, s, map[string]interface{}{
+		"tracing_otlp_endpoint": collector.URL + "/v1/traces",
+		"tracing_sample_ratio":  1.0,
+	})
+
+	_, span := b.startLoginSpan(context.Background(), &logical.Request{Storage: s}, loginMethodKratosSession)
+	span.End()
+
+	start := time.Now()
+	b.closeTracer()
+
+	_, err := b.getTracer(context.Background(), s)
+	if err != nil {
+		t.Fatalf("getting tracer: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("closing the tracer held logins for %s while spans were exported", elapsed)
+	}
+}